@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"gitea.kood.tech/innocentkwizera1/stations/batch"
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+)
+
+// runBatch sweeps train counts and start/end pairs over a set of maps:
+// stations batch [-trains 1-100] [-workers n] [-format csv|json] [map...]
+// Without maps it uses every map in test_maps/. Maps with more than
+// batch.MaxPairs pairs of stations are skipped.
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	trains := fs.String("trains", "1-100", "train counts to run, a number or a range like 1-100")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "simulations to run at once")
+	format := fs.String("format", "csv", "output format, csv or json")
+	timeout := fs.Duration("timeout", 0, "stop the batch after this long, e.g. 10m")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	minTrains, maxTrains, err := batch.ParseTrainCounts(*trains)
+	if err != nil {
+		return err
+	}
+
+	maps := fs.Args()
+	if len(maps) == 0 {
+		maps, _ = filepath.Glob(filepath.Join("test_maps", "*.map"))
+	}
+	cases := []batch.Case{}
+	for _, path := range maps {
+		network, err := parser.ParseFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+			continue
+		}
+		sweep, err := batch.Sweep(path, network, minTrains, maxTrains)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+			continue
+		}
+		cases = append(cases, sweep...)
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	results, err := batch.Run(ctx, cases, *workers)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		return batch.WriteJSON(os.Stdout, results)
+	}
+	return batch.WriteCSV(os.Stdout, results)
+}
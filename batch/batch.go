@@ -0,0 +1,147 @@
+// Package batch runs many simulations on a pool of workers, e.g. to sweep
+// train counts and start/end pairs across a set of maps
+package batch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/graph"
+	"gitea.kood.tech/innocentkwizera1/stations/simulation"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// Case is one simulation to run. Cases may share a network and its
+// pathfinder; both are only read. Without a pathfinder the case builds its
+// own.
+type Case struct {
+	Map        string
+	Network    *types.Network
+	Pathfinder *graph.AdvancedPathfinder
+	Start      string
+	End        string
+	Trains     int
+}
+
+// Result is the outcome of one case
+type Result struct {
+	Map        string  `json:"map"`
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Trains     int     `json:"trains"`
+	Turns      int     `json:"turns"`
+	LowerBound int     `json:"lower_bound"`
+	RuntimeMS  float64 `json:"runtime_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// MaxPairs is the most ordered pairs of stations Sweep takes on. Their
+// number grows with the square of the stations, so a sweep of a large map
+// would run for hours.
+const MaxPairs = 1000
+
+// Sweep returns a case for every ordered pair of distinct stations of the
+// network with a path between them, and every train count from minTrains to
+// maxTrains. Pairs come in name order. The cases share one pathfinder. It
+// fails with ErrSweepTooLarge for a network with more than MaxPairs pairs.
+func Sweep(name string, network *types.Network, minTrains, maxTrains int) ([]Case, error) {
+	n := len(network.Stations)
+	if n*(n-1) > MaxPairs {
+		return nil, fmt.Errorf("%w: %d stations make %d pairs, at most %d", errors.ErrSweepTooLarge, n, n*(n-1), MaxPairs)
+	}
+
+	stations := make([]string, 0, n)
+	for station := range network.Stations {
+		stations = append(stations, station)
+	}
+	sort.Strings(stations)
+
+	compact := graph.NewCompact(network)
+	pathfinder := graph.NewAdvancedPathfinderFromCompact(network, compact)
+	cases := []Case{}
+	for _, start := range stations {
+		for _, end := range stations {
+			if start == end || !compact.PathExists(start, end) {
+				continue
+			}
+			for trains := minTrains; trains <= maxTrains; trains++ {
+				cases = append(cases, Case{Map: name, Network: network, Pathfinder: pathfinder, Start: start, End: end, Trains: trains})
+			}
+		}
+	}
+	return cases, nil
+}
+
+// ParseTrainCounts reads a train count like "5", or a range like "1-100",
+// and returns the first and last count
+func ParseTrainCounts(s string) (int, int, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		to = from
+	}
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 1 {
+		return 0, 0, errors.ErrInvalidTrainCount
+	}
+	last, err := strconv.Atoi(to)
+	if err != nil || last < first || last > 10000 {
+		return 0, 0, errors.ErrInvalidTrainCount
+	}
+	return first, last, nil
+}
+
+// Run simulates every case on workers goroutines, each case with its own
+// simulator, and returns the results in the order of cases. A case that
+// fails, e.g. in a deadlock, records the error in its result. Run stops with
+// a CanceledError once ctx is done.
+func Run(ctx context.Context, cases []Case, workers int) ([]Result, error) {
+	results := make([]Result, len(cases))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runCase(ctx, cases[i])
+			}
+		}()
+	}
+	for i := 0; i < len(cases) && ctx.Err() == nil; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := errors.Canceled(ctx, "batch"); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func runCase(ctx context.Context, c Case) Result {
+	result := Result{Map: c.Map, Start: c.Start, End: c.End, Trains: c.Trains}
+	began := time.Now()
+	pathfinder := c.Pathfinder
+	if pathfinder == nil {
+		pathfinder = graph.NewAdvancedPathfinder(c.Network)
+	}
+	simulator := simulation.NewSimulatorWithPathfinder(c.Network, pathfinder, c.Start, c.End, c.Trains)
+	err := simulator.RunFuncContext(ctx, func(int, []simulation.TrainMove) error { return nil })
+	result.RuntimeMS = float64(time.Since(began).Microseconds()) / 1000
+	result.Turns = simulator.Turn()
+	result.LowerBound = simulator.LowerBound()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,176 @@
+package batch
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// lineMap is a line a-b-c and a station d on its own
+const lineMap = "stations:\na,0,0\nb,1,0\nc,2,0\nd,5,5\n\nconnections:\na-b\nb-c\n"
+
+func parseMap(t *testing.T, text string) *types.Network {
+	t.Helper()
+	network, err := parser.Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return network
+}
+
+func TestSweep(t *testing.T) {
+	network := parseMap(t, lineMap)
+	cases, err := Sweep("line", network, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range cases {
+		if c.Map != "line" || c.Network != network {
+			t.Errorf("case %+v is not for the map swept", c)
+		}
+		if c.Pathfinder == nil || c.Pathfinder != cases[0].Pathfinder {
+			t.Errorf("%s-%s does not share the pathfinder", c.Start, c.End)
+		}
+		got = append(got, fmt.Sprintf("%s-%s/%d", c.Start, c.End, c.Trains))
+	}
+	want := "a-b/2 a-b/3 a-c/2 a-c/3 b-a/2 b-a/3 b-c/2 b-c/3 c-a/2 c-a/3 c-b/2 c-b/3"
+	if strings.Join(got, " ") != want {
+		t.Errorf("swept %v, want %s", got, want)
+	}
+}
+
+func TestSweepTooLarge(t *testing.T) {
+	// 33 stations make 1056 ordered pairs
+	var text strings.Builder
+	text.WriteString("stations:\n")
+	for i := 0; i < 33; i++ {
+		fmt.Fprintf(&text, "s%d,%d,0\n", i, i)
+	}
+	text.WriteString("\nconnections:\n")
+	for i := 1; i < 33; i++ {
+		fmt.Fprintf(&text, "s%d-s%d\n", i-1, i)
+	}
+
+	_, err := Sweep("long", parseMap(t, text.String()), 1, 1)
+	if !stderrors.Is(err, errors.ErrSweepTooLarge) {
+		t.Errorf("got error %v, want %v", err, errors.ErrSweepTooLarge)
+	}
+}
+
+func TestRun(t *testing.T) {
+	network := parseMap(t, lineMap)
+	cases, err := Sweep("line", network, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// d cannot be reached, so the run fails
+	cases = append(cases, Case{Map: "line", Network: network, Start: "a", End: "d", Trains: 1})
+
+	serial, err := Run(context.Background(), cases, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Run(context.Background(), cases, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(cases) {
+		t.Fatalf("got %d results for %d cases", len(results), len(cases))
+	}
+
+	for i, r := range results {
+		c := cases[i]
+		if r.Map != c.Map || r.Start != c.Start || r.End != c.End || r.Trains != c.Trains {
+			t.Errorf("result %d is %+v, for case %+v", i, r, c)
+		}
+		if r.Turns != serial[i].Turns || r.LowerBound != serial[i].LowerBound || r.Error != serial[i].Error {
+			t.Errorf("%s-%s/%d: %+v on 4 workers, %+v on one", c.Start, c.End, c.Trains, r, serial[i])
+		}
+		if c.End == "d" {
+			if r.Error == "" {
+				t.Errorf("%s-%s: no error recorded", c.Start, c.End)
+			}
+			continue
+		}
+		if r.Error != "" || r.Turns < r.LowerBound || r.LowerBound == 0 {
+			t.Errorf("%s-%s/%d: %+v", c.Start, c.End, c.Trains, r)
+		}
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	network := parseMap(t, lineMap)
+	cases, err := Sweep("line", network, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	for _, tt := range []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{"canceled", canceled, context.Canceled},
+		{"timed out", expired, context.DeadlineExceeded},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Run(tt.ctx, cases, 2)
+			var canceledErr *errors.CanceledError
+			if !stderrors.As(err, &canceledErr) || !stderrors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want a CanceledError for %v", err, tt.wantErr)
+			}
+			if results != nil {
+				t.Errorf("got %d results from a canceled batch", len(results))
+			}
+		})
+	}
+}
+
+func TestParseTrainCounts(t *testing.T) {
+	tests := []struct {
+		input       string
+		first, last int
+		wantErr     bool
+	}{
+		{input: "5", first: 5, last: 5},
+		{input: "1-100", first: 1, last: 100},
+		{input: "3-3", first: 3, last: 3},
+		{input: "1-10000", first: 1, last: 10000},
+		{input: "", wantErr: true},
+		{input: "0", wantErr: true},
+		{input: "-5", wantErr: true},
+		{input: "5-2", wantErr: true},
+		{input: "1-10001", wantErr: true},
+		{input: "1-", wantErr: true},
+		{input: "a-b", wantErr: true},
+		{input: "1-2-3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			first, last, err := ParseTrainCounts(tt.input)
+			if tt.wantErr {
+				if !stderrors.Is(err, errors.ErrInvalidTrainCount) {
+					t.Errorf("got %d-%d, error %v, want %v", first, last, err, errors.ErrInvalidTrainCount)
+				}
+				return
+			}
+			if err != nil || first != tt.first || last != tt.last {
+				t.Errorf("got %d-%d, error %v, want %d-%d", first, last, err, tt.first, tt.last)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package batch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes results as a table with a header row
+func WriteCSV(w io.Writer, results []Result) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"map", "start", "end", "trains", "turns", "lower_bound", "runtime_ms", "error"})
+	for _, r := range results {
+		out.Write([]string{
+			r.Map,
+			r.Start,
+			r.End,
+			strconv.Itoa(r.Trains),
+			strconv.Itoa(r.Turns),
+			strconv.Itoa(r.LowerBound),
+			strconv.FormatFloat(r.RuntimeMS, 'f', 3, 64),
+			r.Error,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteJSON writes results as a JSON array
+func WriteJSON(w io.Writer, results []Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
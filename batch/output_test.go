@@ -0,0 +1,52 @@
+package batch
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var results = []Result{
+	{Map: "line.map", Start: "a", End: "c", Trains: 2, Turns: 3, LowerBound: 3, RuntimeMS: 0.25},
+	{Map: "line.map", Start: "a", End: "d", Trains: 1, Turns: 1, RuntimeMS: 1.5, Error: "no path, \"d\" is on its own"},
+}
+
+func TestWriteCSV(t *testing.T) {
+	var out strings.Builder
+	if err := WriteCSV(&out, results); err != nil {
+		t.Fatal(err)
+	}
+	want := "map,start,end,trains,turns,lower_bound,runtime_ms,error\n" +
+		"line.map,a,c,2,3,3,0.250,\n" +
+		"line.map,a,d,1,1,0,1.500,\"no path, \"\"d\"\" is on its own\"\n"
+	if out.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out strings.Builder
+	if err := WriteJSON(&out, results); err != nil {
+		t.Fatal(err)
+	}
+
+	var fields []map[string]any
+	if err := json.Unmarshal([]byte(out.String()), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields[0]["error"]; ok {
+		t.Errorf("a result without an error has one: %v", fields[0])
+	}
+	if fields[1]["lower_bound"] != 0.0 || fields[1]["runtime_ms"] != 1.5 {
+		t.Errorf("wrote %v", fields[1])
+	}
+
+	var got []Result
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, results) {
+		t.Errorf("read back %+v, want %+v", got, results)
+	}
+}
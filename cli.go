@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitea.kood.tech/innocentkwizera1/stations/simulation"
+)
+
+// options are the flags accepted next to the positional arguments
+type options struct {
+	explain          bool
+	reroute          bool
+	rerouteSlack     int
+	resolveDeadlocks bool
+	maxTurns         int
+	timeout          time.Duration
+	scenario         string
+	aging            int
+	reliability      string
+	runs             int
+	seed             uint64
+	service          simulation.Service
+	cycles           int
+}
+
+// parseArgs reads flags from anywhere on the command line and returns them
+// with the remaining positional arguments
+func parseArgs(args []string) (options, []string, error) {
+	var opts options
+	fs := flag.NewFlagSet("stations", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.explain, "explain", false, "explain on stderr why trains wait")
+	fs.BoolVar(&opts.reroute, "reroute", false, "let blocked trains take another free route")
+	fs.IntVar(&opts.rerouteSlack, "reroute-slack", 0, "extra connections rerouting may add to a leg")
+	fs.BoolVar(&opts.resolveDeadlocks, "resolve-deadlocks", false, "reroute or back off a train to break deadlocks")
+	fs.IntVar(&opts.maxTurns, "max-turns", 0, "turn limit (default derived from the routes)")
+	fs.DurationVar(&opts.timeout, "timeout", 0, "stop the simulation after this long, e.g. 30s")
+	fs.StringVar(&opts.scenario, "scenario", "", "file with per-train departures, deadlines, classes and priorities")
+	fs.IntVar(&opts.aging, "aging", simulation.DefaultAgingTurns, "turns a train waits per priority step it gains; 0 disables")
+	fs.StringVar(&opts.reliability, "reliability", "", "file with failure probabilities to run a Monte Carlo simulation with")
+	fs.IntVar(&opts.runs, "runs", 1000, "randomised runs of the Monte Carlo simulation")
+	fs.Uint64Var(&opts.seed, "seed", 1, "seed of the Monte Carlo simulation")
+	fs.Func("service", "oneway, shuttle (back the same way) or loop (back another way)", func(name string) error {
+		service, ok := simulation.ParseService(name)
+		if !ok {
+			return fmt.Errorf("unknown service %q", name)
+		}
+		opts.service = service
+		return nil
+	})
+	fs.IntVar(&opts.cycles, "cycles", 1, "round trips of a shuttle or loop service")
+
+	flags, positional := splitArgs(fs, args)
+	if err := fs.Parse(flags); err != nil {
+		return opts, nil, err
+	}
+	if opts.runs < 1 {
+		return opts, nil, fmt.Errorf("-runs must be at least 1, got %d", opts.runs)
+	}
+	return opts, positional, nil
+}
+
+// splitArgs separates flags from positional arguments. Negative numbers,
+// like a train count of -3, stay positional so they are reported by the
+// usual validation.
+func splitArgs(fs *flag.FlagSet, args []string) (flags, positional []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if _, err := strconv.Atoi(arg); err == nil || !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		flags = append(flags, arg)
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return flags, positional
+}
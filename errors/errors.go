@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -22,8 +23,43 @@ var (
 	ErrStartStationNotFound = errors.New("start station does not exist")
 	ErrEndStationNotFound   = errors.New("end station does not exist")
 	ErrMapTooLarge         = errors.New("map contains more than 10000 stations")
+	ErrDeadlock             = errors.New("deadlock")
+	ErrTurnLimit            = errors.New("simulation exceeded maximum turns")
+	ErrInvalidScenario      = errors.New("invalid scenario")
+	ErrClosedOff            = errors.New("closures leave no way to the destination")
+	ErrInvalidDwell         = errors.New("dwell time must name a known station and a non-negative number of turns")
+	ErrInvalidHeadway       = errors.New("headway must be stations=N or turns=N with N non-negative")
+	ErrInvalidSignalBlock   = errors.New("signal block must have a unique name and connected, known connections in no other block")
+	ErrInvalidReliability   = errors.New("invalid reliability file")
+	ErrInvalidCapacity      = errors.New("capacity must name a known station once, and a positive number of trains")
+	ErrDepotFull            = errors.New("depot cannot hold every train of the run")
+	ErrLoopTooShort         = errors.New("loop is too short for a train to run round it")
+	ErrSweepTooLarge        = errors.New("map has too many stations to sweep every pair")
 )
 
+// CanceledError reports work that stopped because its context was canceled
+// or its deadline passed. It unwraps to the context's error.
+type CanceledError struct {
+	Op  string
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("%s canceled: %v", e.Op, e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Canceled returns a CanceledError for op if ctx is done, or nil
+func Canceled(ctx context.Context, op string) error {
+	if err := ctx.Err(); err != nil {
+		return &CanceledError{Op: op, Err: err}
+	}
+	return nil
+}
+
 func PrintError(err error) {
 	fmt.Fprintln(os.Stderr, "Error:", err)
 }
@@ -1,9 +1,11 @@
 package graph
 
 import (
+	"context"
 	"fmt"
 	"math"
 
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
 	"gitea.kood.tech/innocentkwizera1/stations/types"
 )
 
@@ -16,40 +18,76 @@ type FlowNetwork struct {
 	n        int            // number of nodes
 }
 
-// AdvancedPathfinder uses max-flow algorithms for optimal train routing
+// AdvancedPathfinder uses max-flow algorithms for optimal train routing. It
+// only reads the network, so one pathfinder can serve concurrent queries.
 type AdvancedPathfinder struct {
 	network *types.Network
-	graph   *Graph
+	compact *Compact
 }
 
 func NewAdvancedPathfinder(network *types.Network) *AdvancedPathfinder {
+	return NewAdvancedPathfinderFromCompact(network, NewCompact(network))
+}
+
+// NewAdvancedPathfinderFromCompact is NewAdvancedPathfinder for a network
+// whose compact graph is already built
+func NewAdvancedPathfinderFromCompact(network *types.Network, compact *Compact) *AdvancedPathfinder {
 	return &AdvancedPathfinder{
 		network: network,
-		graph:   BuildGraph(network),
+		compact: compact,
 	}
 }
 
 // FindOptimalPaths finds the optimal paths for multiple trains using max-flow
 func (apf *AdvancedPathfinder) FindOptimalPaths(start, end string, numTrains int) [][]string {
+	paths, _ := apf.FindOptimalPathsContext(context.Background(), start, end, numTrains)
+	return paths
+}
+
+// FindOptimalPathsContext is FindOptimalPaths, returning a CanceledError as
+// soon as ctx is done
+func (apf *AdvancedPathfinder) FindOptimalPathsContext(ctx context.Context, start, end string, numTrains int) ([][]string, error) {
 	// First, try to find multiple shortest paths
-	shortestPaths := apf.findMultipleShortestPaths(start, end, numTrains)
+	shortestPaths, err := apf.findMultipleShortestPaths(ctx, start, end, numTrains)
+	if err != nil {
+		return nil, err
+	}
 	
 	if len(shortestPaths) >= numTrains {
-		return shortestPaths[:numTrains]
+		return shortestPaths[:numTrains], nil
 	}
 	
 	// If we don't have enough paths, use flow-based approach
-	return apf.findFlowBasedPaths(start, end, numTrains)
+	return apf.findFlowBasedPaths(ctx, start, end, numTrains)
+}
+
+// FindDisjointPaths returns up to k station-disjoint paths of minimal total
+// length and dwell, so trains on different paths never meet between start
+// and end
+func (apf *AdvancedPathfinder) FindDisjointPaths(start, end string, k int) [][]string {
+	return apf.compact.FindDisjointPaths(start, end, k)
+}
+
+// FindDisjointPathsContext is FindDisjointPaths, returning a CanceledError as
+// soon as ctx is done
+func (apf *AdvancedPathfinder) FindDisjointPathsContext(ctx context.Context, start, end string, k int) ([][]string, error) {
+	return apf.compact.FindDisjointPathsContext(ctx, start, end, k)
+}
+
+// FindPathAvoiding returns a shortest path from start to end that avoids the
+// given stations and tracks, or nil if there is none
+func (apf *AdvancedPathfinder) FindPathAvoiding(start, end string, stations map[string]bool, tracks map[[2]string]bool) []string {
+	return apf.compact.FindShortestPathAvoiding(start, end, stations, tracks)
 }
 
 // findMultipleShortestPaths finds multiple shortest paths using node-disjoint and edge-disjoint approaches  
-func (apf *AdvancedPathfinder) findMultipleShortestPaths(start, end string, maxPaths int) [][]string {
+func (apf *AdvancedPathfinder) findMultipleShortestPaths(ctx context.Context, start, end string, maxPaths int) ([][]string, error) {
 	paths := [][]string{}
 	
 	// Find the first shortest path
-	firstPath := apf.graph.FindShortestPath(start, end)
+	firstPath := apf.compact.FindShortestPath(start, end)
 	if firstPath == nil {
-		return paths
+		return paths, nil
 	}
 	
 	paths = append(paths, firstPath)
@@ -60,6 +98,9 @@ func (apf *AdvancedPathfinder) findMultipleShortestPaths(start, end string, maxP
 	usedEdges := make(map[string]bool)
 	
 	for len(paths) < maxPaths {
+		if err := errors.Canceled(ctx, "optimal paths"); err != nil {
+			return nil, err
+		}
 		bestPath := []string{}
 		bestScore := math.MaxInt32
 		
@@ -70,8 +111,7 @@ func (apf *AdvancedPathfinder) findMultipleShortestPaths(start, end string, maxP
 					continue
 				}
 				
-				tempGraph := apf.copyGraphWithoutNode(path[i])
-				altPath := tempGraph.FindShortestPath(start, end)
+				altPath := apf.pathWithoutNode(start, end, path[i])
 				
 				if altPath != nil && len(altPath) <= shortestLength+2 {
 					score := apf.calculatePathScore(altPath, paths)
@@ -91,8 +131,7 @@ func (apf *AdvancedPathfinder) findMultipleShortestPaths(start, end string, maxP
 					continue
 				}
 				
-				tempGraph := apf.copyGraphWithoutEdge(path[i], path[i+1])
-				altPath := tempGraph.FindShortestPath(start, end)
+				altPath := apf.pathWithoutEdge(start, end, path[i], path[i+1])
 				
 				if altPath != nil && len(altPath) <= shortestLength+2 {
 					score := apf.calculatePathScore(altPath, paths)
@@ -119,25 +158,28 @@ func (apf *AdvancedPathfinder) findMultipleShortestPaths(start, end string, maxP
 		}
 	}
 	
-	return paths
+	return paths, nil
 }
 
 // findFlowBasedPaths uses max-flow to find optimal paths
-func (apf *AdvancedPathfinder) findFlowBasedPaths(start, end string, numTrains int) [][]string {
+func (apf *AdvancedPathfinder) findFlowBasedPaths(ctx context.Context, start, end string, numTrains int) ([][]string, error) {
 	// Create time-expanded graph
 	maxTime := apf.estimateMaxTime(start, end, numTrains)
 	flowNet := apf.createTimeExpandedNetwork(start, end, maxTime)
 	
 	// Find maximum flow
-	maxFlow := apf.dinicMaxFlow(flowNet, 0, flowNet.n-1)
+	maxFlow, err := apf.dinicMaxFlow(ctx, flowNet, 0, flowNet.n-1)
+	if err != nil {
+		return nil, err
+	}
 	
 	if maxFlow < numTrains {
 		// Fallback to simple paths
-		return apf.generateSimplePaths(start, end, numTrains)
+		return apf.generateSimplePaths(ctx, start, end, numTrains)
 	}
 	
 	// Decompose flow into paths
-	return apf.decomposeFlowToPaths(flowNet, start, end, numTrains, maxTime)
+	return apf.decomposeFlowToPaths(flowNet, start, end, numTrains, maxTime), nil
 }
 
 // createTimeExpandedNetwork creates a time-expanded network for flow computation
@@ -186,9 +228,16 @@ func (apf *AdvancedPathfinder) createTimeExpandedNetwork(start, end string, maxT
 				capacity[currentNode][nextNode] = math.MaxInt32
 			}
 			
-			// Move to neighboring stations
+			// Move to neighboring stations, after dwelling at intermediate ones
+			departAt := t
+			if station != start && station != end {
+				departAt += apf.network.Stations[station].Dwell
+			}
+			if departAt >= maxTime {
+				continue
+			}
 			for _, neighbor := range neighbors {
-				nextNode := nodeMap[fmt.Sprintf("%s_%d", neighbor, t+1)]
+				nextNode := nodeMap[fmt.Sprintf("%s_%d", neighbor, departAt+1)]
 				capacity[currentNode][nextNode] = 1 // Only one train per track per time
 			}
 		}
@@ -204,18 +253,22 @@ func (apf *AdvancedPathfinder) createTimeExpandedNetwork(start, end string, maxT
 }
 
 // dinicMaxFlow implements Dinic's algorithm for maximum flow
-func (apf *AdvancedPathfinder) dinicMaxFlow(fn *FlowNetwork, source, sink int) int {
+func (apf *AdvancedPathfinder) dinicMaxFlow(ctx context.Context, fn *FlowNetwork, source, sink int) (int, error) {
 	// Initialize flow matrix
 	for i := range fn.flow {
 		fn.flow[i] = make([]int, fn.n)
 	}
 	
 	maxFlow := 0
+	level := make([]int, fn.n)
 	
-	for apf.bfsLevel(fn, source, sink) {
+	for apf.bfsLevel(fn, source, sink, level) {
 		iter := make([]int, fn.n)
 		for {
-			pushed := apf.dfsFlow(fn, source, sink, math.MaxInt32, iter)
+			if err := errors.Canceled(ctx, "max flow"); err != nil {
+				return maxFlow, err
+			}
+			pushed := apf.dfsFlow(fn, source, sink, math.MaxInt32, iter, level)
 			if pushed == 0 {
 				break
 			}
@@ -223,12 +276,11 @@ func (apf *AdvancedPathfinder) dinicMaxFlow(fn *FlowNetwork, source, sink int) i
 		}
 	}
 	
-	return maxFlow
+	return maxFlow, nil
 }
 
 // bfsLevel builds level graph for Dinic's algorithm
-func (apf *AdvancedPathfinder) bfsLevel(fn *FlowNetwork, source, sink int) bool {
-	level := make([]int, fn.n)
+func (apf *AdvancedPathfinder) bfsLevel(fn *FlowNetwork, source, sink int, level []int) bool {
 	for i := range level {
 		level[i] = -1
 	}
@@ -251,16 +303,17 @@ func (apf *AdvancedPathfinder) bfsLevel(fn *FlowNetwork, source, sink int) bool
 	return level[sink] >= 0
 }
 
-// dfsFlow performs DFS to find blocking flow
-func (apf *AdvancedPathfinder) dfsFlow(fn *FlowNetwork, v, sink, pushed int, iter []int) int {
+// dfsFlow performs DFS to find blocking flow. It only follows arcs one level
+// deeper, which keeps the search acyclic.
+func (apf *AdvancedPathfinder) dfsFlow(fn *FlowNetwork, v, sink, pushed int, iter, level []int) int {
 	if v == sink {
 		return pushed
 	}
 	
 	for iter[v] < fn.n {
 		to := iter[v]
-		if fn.capacity[v][to]-fn.flow[v][to] > 0 {
-			tr := apf.dfsFlow(fn, to, sink, min(pushed, fn.capacity[v][to]-fn.flow[v][to]), iter)
+		if level[to] == level[v]+1 && fn.capacity[v][to]-fn.flow[v][to] > 0 {
+			tr := apf.dfsFlow(fn, to, sink, min(pushed, fn.capacity[v][to]-fn.flow[v][to]), iter, level)
 			if tr > 0 {
 				fn.flow[v][to] += tr
 				fn.flow[to][v] -= tr
@@ -275,12 +328,15 @@ func (apf *AdvancedPathfinder) dfsFlow(fn *FlowNetwork, v, sink, pushed int, ite
 
 // Helper functions
 func (apf *AdvancedPathfinder) estimateMaxTime(start, end string, numTrains int) int {
-	shortestPath := apf.graph.FindShortestPath(start, end)
+	shortestPath := apf.compact.FindShortestPath(start, end)
 	if shortestPath == nil {
 		return numTrains * 10 // fallback
 	}
 	
 	baseTime := len(shortestPath) - 1
+	for _, station := range shortestPath[1 : len(shortestPath)-1] {
+		baseTime += apf.network.Stations[station].Dwell
+	}
 	return baseTime + numTrains + 5 // Add buffer for congestion
 }
 
@@ -313,49 +369,16 @@ func (apf *AdvancedPathfinder) calculateOverlap(path1, path2 []string) int {
 	return overlap
 }
 
-func (apf *AdvancedPathfinder) copyGraphWithoutNode(excludeNode string) *Graph {
-	newGraph := NewGraph()
-	
-	// Add all nodes except the excluded one
-	for name := range apf.graph.Nodes {
-		if name != excludeNode {
-			newGraph.AddNode(name)
-		}
-	}
-	
-	// Add all edges not involving the excluded node
-	for _, node := range apf.graph.Nodes {
-		if node.Name != excludeNode {
-			for _, neighbor := range node.Neighbors {
-				if neighbor.Name != excludeNode {
-					newGraph.AddEdge(node.Name, neighbor.Name)
-				}
-			}
-		}
-	}
-	
-	return newGraph
+// pathWithoutNode finds a shortest path that avoids excludeNode. A station
+// the network does not have excludes nothing.
+func (apf *AdvancedPathfinder) pathWithoutNode(start, end, excludeNode string) []string {
+	return apf.compact.FindShortestPathAvoiding(start, end, map[string]bool{excludeNode: true}, nil)
 }
 
-func (apf *AdvancedPathfinder) copyGraphWithoutEdge(from, to string) *Graph {
-	newGraph := NewGraph()
-	
-	// Copy all nodes
-	for name := range apf.graph.Nodes {
-		newGraph.AddNode(name)
-	}
-	
-	// Copy all edges except the specified one
-	for _, node := range apf.graph.Nodes {
-		for _, neighbor := range node.Neighbors {
-			if !(node.Name == from && neighbor.Name == to) &&
-				!(node.Name == to && neighbor.Name == from) {
-				newGraph.AddEdge(node.Name, neighbor.Name)
-			}
-		}
-	}
-	
-	return newGraph
+// pathWithoutEdge finds a shortest path that doesn't use the track between
+// from and to in either direction
+func (apf *AdvancedPathfinder) pathWithoutEdge(start, end, from, to string) []string {
+	return apf.compact.FindShortestPathAvoiding(start, end, nil, map[[2]string]bool{{from, to}: true})
 }
 
 func (apf *AdvancedPathfinder) getEdgeKey(from, to string) string {
@@ -365,19 +388,22 @@ func (apf *AdvancedPathfinder) getEdgeKey(from, to string) string {
 	return to + "-" + from
 }
 
-func (apf *AdvancedPathfinder) generateSimplePaths(start, end string, numTrains int) [][]string {
+func (apf *AdvancedPathfinder) generateSimplePaths(ctx context.Context, start, end string, numTrains int) ([][]string, error) {
 	paths := [][]string{}
-	shortestPath := apf.graph.FindShortestPath(start, end)
+	shortestPath := apf.compact.FindShortestPath(start, end)
 	
 	if shortestPath == nil {
-		return paths
+		return paths, nil
 	}
 	
 	// Generate paths with slight variations
 	for i := 0; i < numTrains; i++ {
 		if i < 3 {
 			// Use different algorithms for first few paths
-			path := apf.findAlternatePath(start, end, i)
+			path, err := apf.findAlternatePath(ctx, start, end, i)
+			if err != nil {
+				return nil, err
+			}
 			if path != nil {
 				paths = append(paths, path)
 			} else {
@@ -388,52 +414,62 @@ func (apf *AdvancedPathfinder) generateSimplePaths(start, end string, numTrains
 		}
 	}
 	
-	return paths
+	return paths, nil
 }
 
-func (apf *AdvancedPathfinder) findAlternatePath(start, end string, variant int) []string {
+func (apf *AdvancedPathfinder) findAlternatePath(ctx context.Context, start, end string, variant int) ([]string, error) {
 	// Try different approaches based on variant
 	switch variant {
 	case 0:
-		return apf.graph.FindShortestPath(start, end)
+		return apf.compact.FindShortestPath(start, end), nil
 	case 1:
-		return apf.findSecondShortestPath(start, end)
+		return apf.findSecondShortestPath(start, end), nil
 	case 2:
-		return apf.findLongestShortestPath(start, end)
+		return apf.findLongestShortestPath(ctx, start, end)
 	default:
-		return apf.graph.FindShortestPath(start, end)
+		return apf.compact.FindShortestPath(start, end), nil
 	}
 }
 
 func (apf *AdvancedPathfinder) findSecondShortestPath(start, end string) []string {
-	firstPath := apf.graph.FindShortestPath(start, end)
+	firstPath := apf.compact.FindShortestPath(start, end)
 	if firstPath == nil || len(firstPath) < 3 {
 		return firstPath
 	}
 	
 	// Try removing middle node
 	middleNode := firstPath[len(firstPath)/2]
-	tempGraph := apf.copyGraphWithoutNode(middleNode)
-	return tempGraph.FindShortestPath(start, end)
+	return apf.pathWithoutNode(start, end, middleNode)
 }
 
-func (apf *AdvancedPathfinder) findLongestShortestPath(start, end string) []string {
+func (apf *AdvancedPathfinder) findLongestShortestPath(ctx context.Context, start, end string) ([]string, error) {
 	// Find a path that's still relatively short but different
-	bestPath := apf.graph.FindShortestPath(start, end)
+	bestPath := apf.compact.FindShortestPath(start, end)
 	if bestPath == nil {
-		return nil
+		return nil, nil
 	}
 	
 	shortestLen := len(bestPath)
+	from, to := apf.compact.index[start], apf.compact.index[end]
 	
 	// Try all possible intermediate nodes
 	for intermediate := range apf.network.Stations {
 		if intermediate == start || intermediate == end {
 			continue
 		}
+		if err := errors.Canceled(ctx, "optimal paths"); err != nil {
+			return nil, err
+		}
+		
+		// Skip stations whose straight-line detour alone rules them out
+		via := apf.compact.index[intermediate]
+		if apf.compact.hopEstimate(from, via)+apf.compact.hopEstimate(via, to) > float64(shortestLen+1) {
+			continue
+		}
 		
-		path1 := apf.graph.FindShortestPath(start, intermediate)
-		path2 := apf.graph.FindShortestPath(intermediate, end)
+		// A* keeps each of these point-to-point queries local on large maps
+		path1 := apf.compact.FindShortestPathAStar(start, intermediate)
+		path2 := apf.compact.FindShortestPathAStar(intermediate, end)
 		
 		if path1 != nil && path2 != nil {
 			totalPath := append(path1[:len(path1)-1], path2...)
@@ -443,7 +479,7 @@ func (apf *AdvancedPathfinder) findLongestShortestPath(start, end string) []stri
 		}
 	}
 	
-	return bestPath
+	return bestPath, nil
 }
 
 func (apf *AdvancedPathfinder) decomposeFlowToPaths(fn *FlowNetwork, start, end string, numTrains, maxTime int) [][]string {
@@ -456,7 +492,7 @@ func (apf *AdvancedPathfinder) decomposeFlowToPaths(fn *FlowNetwork, start, end
 			paths = append(paths, path)
 		} else {
 			// Fallback to shortest path
-			shortestPath := apf.graph.FindShortestPath(start, end)
+			shortestPath := apf.compact.FindShortestPath(start, end)
 			if shortestPath != nil {
 				paths = append(paths, shortestPath)
 			}
@@ -469,7 +505,7 @@ func (apf *AdvancedPathfinder) decomposeFlowToPaths(fn *FlowNetwork, start, end
 func (apf *AdvancedPathfinder) findPathInFlow(fn *FlowNetwork, start, end string, maxTime int) []string {
 	// Simplified path extraction from flow network
 	// In a complete implementation, this would trace actual flow paths
-	return apf.graph.FindShortestPath(start, end)
+	return apf.compact.FindShortestPath(start, end)
 }
 
 func min(a, b int) int {
@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+func TestFindOptimalPaths(t *testing.T) {
+	g := newTestGraph("s-a", "a-t", "s-b", "b-c", "c-t", "a-c")
+	network := &types.Network{Stations: map[string]*types.Station{}, Connections: map[string][]string{}}
+	for name, node := range g.Nodes {
+		network.Stations[name] = &types.Station{Name: name}
+		for _, neighbor := range node.Neighbors {
+			network.Connections[name] = append(network.Connections[name], neighbor.Name)
+		}
+	}
+	apf := NewAdvancedPathfinder(network)
+
+	for _, numTrains := range []int{1, 2, 5} {
+		paths := apf.FindOptimalPaths("s", "t", numTrains)
+		if len(paths) != numTrains {
+			t.Fatalf("%d trains: got %d paths %v", numTrains, len(paths), paths)
+		}
+		for _, path := range paths {
+			checkPath(t, g, path, "s", "t")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := apf.FindOptimalPathsContext(ctx, "s", "t", 5)
+	if canceled, ok := err.(*errors.CanceledError); !ok || canceled.Err != context.Canceled {
+		t.Errorf("canceled context: got error %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package graph
+
+// FindShortestPathAStar returns a path with the fewest connections between
+// start and end. It uses A* guided by the straight-line distance to end,
+// scaled by the longest edge so the heuristic never overestimates.
+func (c *Compact) FindShortestPathAStar(start, end string) []string {
+	path, _ := c.aStar(start, end, func(from, to int32) float64 {
+		return 1
+	}, c.hopEstimate)
+	return path
+}
+
+// FindGeometricPath returns the path between start and end with the
+// shortest total track length, measuring each connection as the straight
+// line between its stations. It also returns that length.
+func (c *Compact) FindGeometricPath(start, end string) ([]string, float64) {
+	return c.aStar(start, end, c.distance, c.distance)
+}
+
+// aStar searches from start to end using cost for each edge and estimate as
+// the admissible heuristic towards end
+func (c *Compact) aStar(start, end string, cost, estimate func(a, b int32) float64) ([]string, float64) {
+	from, okFrom := c.index[start]
+	to, okTo := c.index[end]
+	if !okFrom || !okTo {
+		return nil, 0
+	}
+	if from == to {
+		return []string{start}, 0
+	}
+
+	scratch := c.getScratch()
+	defer c.scratchPool.Put(scratch)
+	generation := scratch.generation
+
+	open := nodeQueue{}
+	scratch.seen[from] = generation
+	scratch.cost[from] = 0
+	open.push(queueItem{node: from, priority: estimate(from, to)})
+
+	for len(open.items) > 0 {
+		current := open.pop().node
+		if scratch.closed[current] == generation {
+			continue
+		}
+		if current == to {
+			return c.pathNames(scratch.trace(from, to)), scratch.cost[to]
+		}
+		scratch.closed[current] = generation
+
+		for _, next := range c.neighbors(current) {
+			if scratch.closed[next] == generation {
+				continue
+			}
+			tentative := scratch.cost[current] + cost(current, next)
+			if scratch.seen[next] == generation && tentative >= scratch.cost[next] {
+				continue
+			}
+			scratch.seen[next] = generation
+			scratch.cost[next] = tentative
+			scratch.parent[next] = current
+			open.push(queueItem{
+				node:     next,
+				priority: tentative + estimate(next, to),
+				cost:     tentative,
+			})
+		}
+	}
+
+	return nil, 0
+}
+
+type queueItem struct {
+	node     int32
+	priority float64
+	cost     float64
+	seq      int
+}
+
+// nodeQueue is a binary min-heap on priority. Ties prefer nodes further from
+// the start, then the order they were pushed, so results are deterministic.
+type nodeQueue struct {
+	items  []queueItem
+	pushed int
+}
+
+func (q *nodeQueue) less(i, j int) bool {
+	a, b := &q.items[i], &q.items[j]
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	if a.cost != b.cost {
+		return a.cost > b.cost
+	}
+	return a.seq < b.seq
+}
+
+func (q *nodeQueue) push(item queueItem) {
+	item.seq = q.pushed
+	q.pushed++
+	q.items = append(q.items, item)
+
+	for i := len(q.items) - 1; i > 0; {
+		p := (i - 1) / 2
+		if !q.less(i, p) {
+			break
+		}
+		q.items[i], q.items[p] = q.items[p], q.items[i]
+		i = p
+	}
+}
+
+func (q *nodeQueue) pop() queueItem {
+	top := q.items[0]
+	last := len(q.items) - 1
+	q.items[0] = q.items[last]
+	q.items = q.items[:last]
+
+	for i := 0; ; {
+		smallest := i
+		if left := 2*i + 1; left < len(q.items) && q.less(left, smallest) {
+			smallest = left
+		}
+		if right := 2*i + 2; right < len(q.items) && q.less(right, smallest) {
+			smallest = right
+		}
+		if smallest == i {
+			break
+		}
+		q.items[i], q.items[smallest] = q.items[smallest], q.items[i]
+		i = smallest
+	}
+
+	return top
+}
@@ -0,0 +1,125 @@
+package graph
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// dijkstra returns the cost of the cheapest path between two stations, or
+// -1 if there is none, to check A* against
+func dijkstra(c *Compact, start, end string, cost func(a, b int32) float64) float64 {
+	dist := make([]float64, c.Len())
+	done := make([]bool, c.Len())
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	dist[c.index[start]] = 0
+
+	for {
+		current := int32(-1)
+		for i := range dist {
+			if !done[i] && !math.IsInf(dist[i], 1) && (current < 0 || dist[i] < dist[current]) {
+				current = int32(i)
+			}
+		}
+		if current < 0 {
+			return -1
+		}
+		if c.names[current] == end {
+			return dist[current]
+		}
+		done[current] = true
+		for _, next := range c.neighbors(current) {
+			dist[next] = math.Min(dist[next], dist[current]+cost(current, next))
+		}
+	}
+}
+
+// pathLength is the straight-line track length of path
+func pathLength(c *Compact, path []string) float64 {
+	length := 0.0
+	for i := 1; i < len(path); i++ {
+		length += c.distance(c.index[path[i-1]], c.index[path[i]])
+	}
+	return length
+}
+
+// newGridGraph builds a size x size grid with stations spaced unevenly, so
+// geometric and hop-count routes differ, and a few missing links
+func newGridGraph(size int) *Graph {
+	g := NewGraph()
+	name := func(x, y int) string { return string(rune('a'+x)) + string(rune('0'+y)) }
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			g.AddNodeAt(name(x, y), x*x+x, 3*y+x%2)
+		}
+	}
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			if x+1 < size && (x+y)%4 != 1 {
+				connect(g, name(x, y)+"-"+name(x+1, y))
+			}
+			if y+1 < size && (x*y)%5 != 3 {
+				connect(g, name(x, y)+"-"+name(x, y+1))
+			}
+		}
+	}
+	return g
+}
+
+func TestAStarMatchesDijkstra(t *testing.T) {
+	g := newGridGraph(6)
+	c := g.Compact()
+	hop := func(a, b int32) float64 { return 1 }
+
+	for _, start := range c.names {
+		for _, end := range c.names {
+			want := dijkstra(c, start, end, hop)
+			path := c.FindShortestPathAStar(start, end)
+			if want < 0 {
+				if path != nil {
+					t.Errorf("%s to %s: got %v, want no path", start, end, path)
+				}
+				continue
+			}
+			checkPath(t, g, path, start, end)
+			if got := float64(len(path) - 1); got != want {
+				t.Errorf("%s to %s: A* path %v has %v connections, Dijkstra %v", start, end, path, got, want)
+			}
+
+			geometric, length := c.FindGeometricPath(start, end)
+			checkPath(t, g, geometric, start, end)
+			want = dijkstra(c, start, end, c.distance)
+			if math.Abs(length-want) > 1e-9 || math.Abs(pathLength(c, geometric)-want) > 1e-9 {
+				t.Errorf("%s to %s: geometric path %v has length %v, Dijkstra %v", start, end, geometric, length, want)
+			}
+		}
+	}
+}
+
+func TestFindGeometricPath(t *testing.T) {
+	// a-d-b and a-c-b both take two connections, but the one through c
+	// stays close to the straight line
+	g := NewGraph()
+	g.AddNodeAt("a", 0, 0)
+	g.AddNodeAt("b", 10, 0)
+	g.AddNodeAt("c", 5, 1)
+	g.AddNodeAt("d", 5, 8)
+	connect(g, "a-d", "d-b", "a-c", "c-b")
+
+	path, length := g.FindGeometricPath("a", "b")
+	if want := []string{"a", "c", "b"}; !reflect.DeepEqual(path, want) {
+		t.Errorf("got %v, want %v", path, want)
+	}
+	if want := 2 * math.Sqrt(26); math.Abs(length-want) > 1e-9 {
+		t.Errorf("got length %v, want %v", length, want)
+	}
+
+	if path, _ := g.FindGeometricPath("a", "missing"); path != nil {
+		t.Errorf("unknown end: got %v", path)
+	}
+	if path := g.FindShortestPathAStar("a", "a"); !reflect.DeepEqual(path, []string{"a"}) {
+		t.Errorf("start == end: got %v", path)
+	}
+}
@@ -0,0 +1,256 @@
+package graph
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// Compact is an immutable, integer-indexed view of a network. Adjacency is
+// stored in CSR form: the neighbours of node i are
+// targets[offsets[i]:offsets[i+1]], in the order the connections were
+// declared. Searches keep their own scratch state, so a Compact can be
+// queried from several goroutines at once.
+type Compact struct {
+	names   []string
+	index   map[string]int32
+	x, y    []int
+	offsets []int32
+	targets []int32
+
+	// dwell is the number of turns a train stopping at each station must
+	// wait there
+	dwell []int
+
+	// longestEdge is the largest straight-line distance covered by one edge,
+	// used to scale the A* heuristic
+	longestEdge float64
+
+	scratchPool sync.Pool
+}
+
+// NewCompact builds a Compact from a parsed network. Nodes are indexed in
+// name order so indices are stable between runs.
+func NewCompact(network *types.Network) *Compact {
+	names := make([]string, 0, len(network.Stations))
+	for name := range network.Stations {
+		names = append(names, name)
+	}
+
+	return buildCompact(names, func(name string) (int, int, int, []string) {
+		station := network.Stations[name]
+		return station.X, station.Y, station.Dwell, network.Connections[name]
+	})
+}
+
+// compactFromGraph snapshots a Graph into a Compact
+func compactFromGraph(g *Graph) *Compact {
+	names := make([]string, 0, len(g.Nodes))
+	for name := range g.Nodes {
+		names = append(names, name)
+	}
+
+	return buildCompact(names, func(name string) (int, int, int, []string) {
+		node := g.Nodes[name]
+		neighbors := make([]string, len(node.Neighbors))
+		for i, neighbor := range node.Neighbors {
+			neighbors[i] = neighbor.Name
+		}
+		return node.X, node.Y, 0, neighbors
+	})
+}
+
+func buildCompact(names []string, describe func(name string) (x, y, dwell int, neighbors []string)) *Compact {
+	sort.Strings(names)
+
+	c := &Compact{
+		names:   names,
+		index:   make(map[string]int32, len(names)),
+		x:       make([]int, len(names)),
+		y:       make([]int, len(names)),
+		dwell:   make([]int, len(names)),
+		offsets: make([]int32, len(names)+1),
+	}
+	for i, name := range names {
+		c.index[name] = int32(i)
+	}
+
+	for i, name := range names {
+		x, y, dwell, neighbors := describe(name)
+		c.x[i], c.y[i], c.dwell[i] = x, y, dwell
+		for _, neighbor := range neighbors {
+			if j, ok := c.index[neighbor]; ok {
+				c.targets = append(c.targets, j)
+			}
+		}
+		c.offsets[i+1] = int32(len(c.targets))
+	}
+
+	for i := range names {
+		for _, j := range c.neighbors(int32(i)) {
+			c.longestEdge = math.Max(c.longestEdge, c.distance(int32(i), j))
+		}
+	}
+
+	return c
+}
+
+// Len returns the number of nodes
+func (c *Compact) Len() int {
+	return len(c.names)
+}
+
+// Has reports whether the named station is in the graph
+func (c *Compact) Has(name string) bool {
+	_, ok := c.index[name]
+	return ok
+}
+
+func (c *Compact) neighbors(i int32) []int32 {
+	return c.targets[c.offsets[i]:c.offsets[i+1]]
+}
+
+// distance is the straight-line distance between two stations
+func (c *Compact) distance(a, b int32) float64 {
+	return math.Hypot(float64(c.x[a]-c.x[b]), float64(c.y[a]-c.y[b]))
+}
+
+// hopEstimate is a lower bound on the number of connections between two
+// stations: no single connection covers more than the longest edge
+func (c *Compact) hopEstimate(a, b int32) float64 {
+	if c.longestEdge == 0 {
+		return 0
+	}
+	return c.distance(a, b) / c.longestEdge
+}
+
+// pathNames converts a path of indices back to station names
+func (c *Compact) pathNames(path []int32) []string {
+	names := make([]string, len(path))
+	for i, n := range path {
+		names[i] = c.names[n]
+	}
+	return names
+}
+
+// FindShortestPath returns a path with the fewest connections between start
+// and end using BFS, or nil if there is none
+func (c *Compact) FindShortestPath(start, end string) []string {
+	return c.shortestPathAvoiding(start, end, nil, nil)
+}
+
+// FindShortestPathAvoiding returns a path with the fewest connections between
+// start and end that passes through none of the given stations and uses none
+// of the given tracks, in either direction
+func (c *Compact) FindShortestPathAvoiding(start, end string, stations map[string]bool, tracks map[[2]string]bool) []string {
+	blockedNodes := make(map[int32]bool, len(stations))
+	for name := range stations {
+		if i, ok := c.index[name]; ok {
+			blockedNodes[i] = true
+		}
+	}
+
+	blockedEdges := make(map[[2]int32]bool, 2*len(tracks))
+	for track := range tracks {
+		a, okA := c.index[track[0]]
+		b, okB := c.index[track[1]]
+		if okA && okB {
+			blockedEdges[[2]int32{a, b}] = true
+			blockedEdges[[2]int32{b, a}] = true
+		}
+	}
+
+	return c.shortestPathAvoiding(start, end, blockedNodes, blockedEdges)
+}
+
+// PathExists reports whether end can be reached from start
+func (c *Compact) PathExists(start, end string) bool {
+	return c.FindShortestPath(start, end) != nil
+}
+
+// shortestPathAvoiding runs a BFS that skips the given nodes and directed
+// edges
+func (c *Compact) shortestPathAvoiding(start, end string, blockedNodes map[int32]bool, blockedEdges map[[2]int32]bool) []string {
+	from, okFrom := c.index[start]
+	to, okTo := c.index[end]
+	if !okFrom || !okTo || blockedNodes[from] {
+		return nil
+	}
+	if from == to {
+		return []string{start}
+	}
+
+	scratch := c.getScratch()
+	defer c.scratchPool.Put(scratch)
+
+	queue := append(scratch.queue[:0], from)
+	scratch.seen[from] = scratch.generation
+
+	for head := 0; head < len(queue); head++ {
+		current := queue[head]
+
+		for _, next := range c.neighbors(current) {
+			if scratch.seen[next] == scratch.generation || blockedNodes[next] || blockedEdges[[2]int32{current, next}] {
+				continue
+			}
+			scratch.seen[next] = scratch.generation
+			scratch.parent[next] = current
+
+			if next == to {
+				scratch.queue = queue
+				return c.pathNames(scratch.trace(from, to))
+			}
+			queue = append(queue, next)
+		}
+	}
+
+	scratch.queue = queue
+	return nil
+}
+
+// searchScratch holds per-search state. Entries are only valid when their
+// stamp matches generation, so a reused scratch needs no clearing.
+type searchScratch struct {
+	generation uint32
+	seen       []uint32
+	closed     []uint32
+	parent     []int32
+	cost       []float64
+	queue      []int32
+}
+
+// getScratch returns a scratch sized for the graph with a fresh generation
+func (c *Compact) getScratch() *searchScratch {
+	n := len(c.names)
+	scratch, _ := c.scratchPool.Get().(*searchScratch)
+	if scratch == nil {
+		scratch = &searchScratch{
+			seen:   make([]uint32, n),
+			closed: make([]uint32, n),
+			parent: make([]int32, n),
+			cost:   make([]float64, n),
+		}
+	}
+	scratch.generation++
+	if scratch.generation == 0 {
+		clear(scratch.seen)
+		clear(scratch.closed)
+		scratch.generation = 1
+	}
+	return scratch
+}
+
+// trace follows parent links from to back to from
+func (s *searchScratch) trace(from, to int32) []int32 {
+	path := []int32{}
+	for n := to; n != from; n = s.parent[n] {
+		path = append(path, n)
+	}
+	path = append(path, from)
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
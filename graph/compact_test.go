@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+func TestNewCompact(t *testing.T) {
+	network := &types.Network{
+		Stations: map[string]*types.Station{
+			"c": {Name: "c", X: 2, Y: 0},
+			"a": {Name: "a", X: 0, Y: 0},
+			"b": {Name: "b", X: 1, Y: 0},
+		},
+		Connections: map[string][]string{
+			"a": {"c", "b"},
+			"b": {"a"},
+			"c": {"a", "missing"},
+		},
+	}
+	c := NewCompact(network)
+
+	if c.Len() != 3 || !c.Has("b") || c.Has("missing") {
+		t.Fatalf("Len %d, Has(b) %v, Has(missing) %v", c.Len(), c.Has("b"), c.Has("missing"))
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(c.names, want) {
+		t.Errorf("stations indexed as %v, want name order %v", c.names, want)
+	}
+
+	// Neighbours keep their declared order and drop unknown stations
+	neighbors := map[string][]string{}
+	for i, name := range c.names {
+		for _, j := range c.neighbors(int32(i)) {
+			neighbors[name] = append(neighbors[name], c.names[j])
+		}
+	}
+	want := map[string][]string{"a": {"c", "b"}, "b": {"a"}, "c": {"a"}}
+	if !reflect.DeepEqual(neighbors, want) {
+		t.Errorf("neighbours %v, want %v", neighbors, want)
+	}
+}
+
+func TestFindShortestPathAvoiding(t *testing.T) {
+	c := newTestGraph("a-b", "b-d", "a-c", "c-d", "d-e").Compact()
+
+	tests := []struct {
+		name     string
+		stations map[string]bool
+		tracks   map[[2]string]bool
+		want     []string
+	}{
+		{name: "nothing avoided", want: []string{"a", "b", "d", "e"}},
+		{name: "station", stations: map[string]bool{"b": true}, want: []string{"a", "c", "d", "e"}},
+		{name: "track either way", tracks: map[[2]string]bool{{"d", "b"}: true}, want: []string{"a", "c", "d", "e"}},
+		{name: "cut", stations: map[string]bool{"d": true}, want: nil},
+		{name: "start", stations: map[string]bool{"a": true}, want: nil},
+		// Station a has index 0; unknown names must not block it
+		{name: "unknown station", stations: map[string]bool{"missing": true}, want: []string{"a", "b", "d", "e"}},
+		{name: "unknown track", tracks: map[[2]string]bool{{"missing", "b"}: true}, want: []string{"a", "b", "d", "e"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.FindShortestPathAvoiding("a", "e", tt.stations, tt.tracks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if c.PathExists("a", "missing") || !c.PathExists("e", "a") {
+		t.Error("PathExists disagrees with the connections")
+	}
+}
+
+// TestCompactConcurrentQueries runs every kind of query on one Compact from
+// many goroutines and checks each against a sequential run. Run it with
+// -race to check the shared scratch pool.
+func TestCompactConcurrentQueries(t *testing.T) {
+	g := newGridGraph(6)
+	c := g.Compact()
+	pairs := [][2]string{{"a0", "f5"}, {"f0", "a5"}, {"c2", "e4"}, {"a0", "a5"}, {"b3", "f1"}}
+
+	query := func(pair [2]string) any {
+		shortest := c.FindShortestPath(pair[0], pair[1])
+		aStar := c.FindShortestPathAStar(pair[0], pair[1])
+		geometric, _ := c.FindGeometricPath(pair[0], pair[1])
+		return [][][]string{
+			{shortest, aStar, geometric},
+			c.FindKShortestPaths(pair[0], pair[1], 4),
+			c.FindDisjointPaths(pair[0], pair[1], 3),
+		}
+	}
+	want := make([]any, len(pairs))
+	for i, pair := range pairs {
+		want[i] = query(pair)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				i := (w + n) % len(pairs)
+				if got := query(pairs[i]); !reflect.DeepEqual(got, want[i]) {
+					t.Errorf("%v: concurrent query got %v, want %v", pairs[i], got, want[i])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Graph queries share one snapshot, built on first use
+	var snapshots sync.Map
+	fresh := newGridGraph(4)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshots.Store(fresh.Compact(), true)
+			fresh.FindShortestPath("a0", "d3")
+		}()
+	}
+	wg.Wait()
+	count := 0
+	snapshots.Range(func(any, any) bool { count++; return true })
+	if count != 1 {
+		t.Errorf("concurrent first use built %d snapshots, want 1", count)
+	}
+}
@@ -0,0 +1,156 @@
+package graph
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+// residualEdge is an arc in the node-split residual network used by
+// FindDisjointPaths. Arcs are stored in pairs so that e^1 is the reverse of e.
+type residualEdge struct {
+	to   int
+	cap  int
+	cost int
+}
+
+// FindDisjointPaths returns up to k vertex-disjoint paths from start to end
+// whose total length is minimal (Suurballe/Bhandari), counting the dwell at
+// every station between start and end as that many more connections. The
+// paths share only start and end. Fewer than k paths are returned when the
+// network doesn't contain k disjoint routes. Paths are ordered by length.
+func (c *Compact) FindDisjointPaths(start, end string, k int) [][]string {
+	paths, _ := c.FindDisjointPathsContext(context.Background(), start, end, k)
+	return paths
+}
+
+// FindDisjointPathsContext is FindDisjointPaths, returning a CanceledError
+// as soon as ctx is done
+func (c *Compact) FindDisjointPathsContext(ctx context.Context, start, end string, k int) ([][]string, error) {
+	from, okFrom := c.index[start]
+	to, okTo := c.index[end]
+	if k <= 0 || !okFrom || !okTo {
+		return nil, nil
+	}
+	if from == to {
+		return [][]string{{start}}, nil
+	}
+
+	// Every station v is split into v_in (2v) and v_out (2v+1) joined by an
+	// arc of capacity 1, so at most one path may pass through it, costing
+	// its dwell.
+	n := 2 * c.Len()
+	adj := make([][]int, n)
+	edges := []residualEdge{}
+	addArc := func(u, v, cap, cost int) {
+		adj[u] = append(adj[u], len(edges))
+		edges = append(edges, residualEdge{to: v, cap: cap, cost: cost})
+		adj[v] = append(adj[v], len(edges))
+		edges = append(edges, residualEdge{to: u, cap: 0, cost: -cost})
+	}
+
+	for i := int32(0); i < int32(c.Len()); i++ {
+		capacity, cost := 1, c.dwell[i]
+		if i == from || i == to {
+			capacity, cost = k, 0
+		}
+		addArc(2*int(i), 2*int(i)+1, capacity, cost)
+	}
+	for i := int32(0); i < int32(c.Len()); i++ {
+		for _, j := range c.neighbors(i) {
+			addArc(2*int(i)+1, 2*int(j), 1, 1)
+		}
+	}
+
+	source := 2*int(from) + 1
+	sink := 2 * int(to)
+
+	// Successive shortest paths: each augmentation along a shortest path in
+	// the residual network keeps the total cost of the flow minimal.
+	found := 0
+	for found < k {
+		if err := errors.Canceled(ctx, "disjoint paths"); err != nil {
+			return nil, err
+		}
+		dist, via := shortestResidualPath(adj, edges, source)
+		if dist[sink] == math.MaxInt32 {
+			break
+		}
+		for v := sink; v != source; v = edges[via[v]^1].to {
+			edges[via[v]].cap--
+			edges[via[v]^1].cap++
+		}
+		found++
+	}
+
+	// Decompose the flow by following saturated forward arcs from the source
+	paths := make([][]string, 0, found)
+	for i := 0; i < found; i++ {
+		path := []string{start}
+		v := source
+		for v != sink {
+			for _, id := range adj[v] {
+				// Forward arcs have even ids; a used one has residual flow on its reverse
+				if id%2 == 0 && edges[id^1].cap > 0 {
+					edges[id^1].cap--
+					v = edges[id].to
+					break
+				}
+			}
+			if v%2 == 0 {
+				path = append(path, c.names[v/2])
+				if v != sink {
+					v++
+				}
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(paths[i]) < len(paths[j])
+	})
+
+	return paths, nil
+}
+
+// shortestResidualPath runs Bellman-Ford (queue based) from source over arcs
+// with remaining capacity. Residual arcs can have negative cost, so Dijkstra
+// cannot be used directly. It returns distances and the arc used to reach
+// each node.
+func shortestResidualPath(adj [][]int, edges []residualEdge, source int) ([]int, []int) {
+	n := len(adj)
+	dist := make([]int, n)
+	via := make([]int, n)
+	inQueue := make([]bool, n)
+	for i := range dist {
+		dist[i] = math.MaxInt32
+		via[i] = -1
+	}
+
+	dist[source] = 0
+	queue := []int{source}
+	inQueue[source] = true
+
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		inQueue[v] = false
+
+		for _, id := range adj[v] {
+			e := edges[id]
+			if e.cap > 0 && dist[v]+e.cost < dist[e.to] {
+				dist[e.to] = dist[v] + e.cost
+				via[e.to] = id
+				if !inQueue[e.to] {
+					inQueue[e.to] = true
+					queue = append(queue, e.to)
+				}
+			}
+		}
+	}
+
+	return dist, via
+}
@@ -0,0 +1,162 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// newTestGraph builds a graph from "a-b" connections, linking both ways like
+// a parsed map
+func newTestGraph(connections ...string) *Graph {
+	g := NewGraph()
+	connect(g, connections...)
+	return g
+}
+
+// connect adds "a-b" connections in both directions, adding missing stations
+// at the origin
+func connect(g *Graph, connections ...string) {
+	for _, connection := range connections {
+		from, to, _ := strings.Cut(connection, "-")
+		g.AddNode(from)
+		g.AddNode(to)
+		g.AddEdge(from, to)
+		g.AddEdge(to, from)
+	}
+}
+
+// checkPath fails unless path runs from start to end along connections of g
+func checkPath(t *testing.T, g *Graph, path []string, start, end string) {
+	t.Helper()
+	if len(path) == 0 || path[0] != start || path[len(path)-1] != end {
+		t.Fatalf("path %v does not run from %s to %s", path, start, end)
+	}
+	for i := 1; i < len(path); i++ {
+		linked := false
+		for _, neighbor := range g.Nodes[path[i-1]].Neighbors {
+			linked = linked || neighbor.Name == path[i]
+		}
+		if !linked {
+			t.Fatalf("path %v uses %s-%s, which is not a connection", path, path[i-1], path[i])
+		}
+	}
+}
+
+func TestFindDisjointPaths(t *testing.T) {
+	tests := []struct {
+		name        string
+		connections []string
+		start, end  string
+		k           int
+		want        int // paths found
+		wantStops   int // stations over all paths
+	}{
+		{
+			name:        "diamond",
+			connections: []string{"s-a", "a-t", "s-b", "b-t"},
+			start:       "s", end: "t", k: 2,
+			want: 2, wantStops: 6,
+		},
+		{
+			// Taking the shortest path s-a-b-t first leaves no second
+			// path, but s-a-d-t and s-c-b-t are disjoint
+			name:        "shortest path blocks the pair",
+			connections: []string{"s-a", "a-b", "b-t", "s-c", "c-b", "a-d", "d-t"},
+			start:       "s", end: "t", k: 2,
+			want: 2, wantStops: 8,
+		},
+		{
+			name:        "detour is longer",
+			connections: []string{"s-t", "s-a", "a-b", "b-t"},
+			start:       "s", end: "t", k: 2,
+			want: 2, wantStops: 6,
+		},
+		{
+			name:        "shared bottleneck",
+			connections: []string{"s-a", "s-b", "a-m", "b-m", "m-t"},
+			start:       "s", end: "t", k: 3,
+			want: 1, wantStops: 4,
+		},
+		{
+			name:        "more paths than asked for",
+			connections: []string{"s-a", "a-t", "s-b", "b-t", "s-c", "c-t"},
+			start:       "s", end: "t", k: 2,
+			want: 2, wantStops: 6,
+		},
+		{
+			name:        "no route",
+			connections: []string{"s-a", "b-t"},
+			start:       "s", end: "t", k: 2,
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGraph(tt.connections...)
+			paths := g.FindDisjointPaths(tt.start, tt.end, tt.k)
+			if len(paths) != tt.want {
+				t.Fatalf("got %d paths %v, want %d", len(paths), paths, tt.want)
+			}
+
+			stops := 0
+			used := make(map[string]bool)
+			for i, path := range paths {
+				checkPath(t, g, path, tt.start, tt.end)
+				if i > 0 && len(path) < len(paths[i-1]) {
+					t.Errorf("paths %v are not ordered by length", paths)
+				}
+				for _, station := range path[1 : len(path)-1] {
+					if used[station] {
+						t.Errorf("paths %v share %s", paths, station)
+					}
+					used[station] = true
+				}
+				stops += len(path)
+			}
+			if stops != tt.wantStops {
+				t.Errorf("paths %v have %d stations, want %d", paths, stops, tt.wantStops)
+			}
+		})
+	}
+}
+
+func TestFindDisjointPathsEdgeCases(t *testing.T) {
+	g := newTestGraph("s-a", "a-t")
+
+	if got := g.FindDisjointPaths("s", "s", 2); !reflect.DeepEqual(got, [][]string{{"s"}}) {
+		t.Errorf("start == end: got %v", got)
+	}
+	if got := g.FindDisjointPaths("s", "t", 0); got != nil {
+		t.Errorf("k = 0: got %v", got)
+	}
+	if got := g.FindDisjointPaths("s", "missing", 1); got != nil {
+		t.Errorf("unknown end: got %v", got)
+	}
+	if got := g.FindDisjointPaths("s", "t", 1); !reflect.DeepEqual(got, [][]string{{"s", "a", "t"}}) {
+		t.Errorf("single path: got %v", got)
+	}
+}
+
+func TestFindDisjointPathsDwell(t *testing.T) {
+	// s-a-t is shorter, but a train stopping at a waits there 3 turns
+	network := &types.Network{
+		Stations: map[string]*types.Station{
+			"s": {Name: "s"}, "a": {Name: "a", Dwell: 3}, "b": {Name: "b"}, "c": {Name: "c"}, "t": {Name: "t", Dwell: 9},
+		},
+		Connections: map[string][]string{
+			"s": {"a", "b"}, "a": {"s", "t"}, "b": {"s", "c"}, "c": {"b", "t"}, "t": {"a", "c"},
+		},
+	}
+	c := NewCompact(network)
+
+	if got, want := c.FindDisjointPaths("s", "t", 1), [][]string{{"s", "b", "c", "t"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("one path: got %v, want %v", got, want)
+	}
+	if got, want := c.FindDisjointPaths("s", "t", 2), [][]string{{"s", "a", "t"}, {"s", "b", "c", "t"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("two paths: got %v, want %v", got, want)
+	}
+}
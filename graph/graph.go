@@ -1,19 +1,28 @@
 package graph
 
 import (
+	"context"
+	"sync"
+
 	"gitea.kood.tech/innocentkwizera1/stations/types"
 )
 
 type Node struct {
 	Name      string
+	X, Y      int
 	Neighbors []*Node
-	Visited   bool
-	Distance  int
-	Parent    *Node
 }
 
+// Graph is a mutable station graph. Query methods run on an immutable
+// Compact snapshot and are safe for concurrent use; AddNode, AddNodeAt and
+// AddEdge must not run concurrently with anything else.
 type Graph struct {
 	Nodes map[string]*Node
+
+	// mu guards compact, the snapshot queries run on. It is dropped whenever
+	// nodes or edges change and rebuilt on the next query.
+	mu      sync.Mutex
+	compact *Compact
 }
 
 func NewGraph() *Graph {
@@ -23,8 +32,14 @@ func NewGraph() *Graph {
 }
 
 func (g *Graph) AddNode(name string) {
+	g.AddNodeAt(name, 0, 0)
+}
+
+// AddNodeAt adds a node with station coordinates, used by A* routing
+func (g *Graph) AddNodeAt(name string, x, y int) {
 	if _, exists := g.Nodes[name]; !exists {
-		g.Nodes[name] = &Node{Name: name, Neighbors: []*Node{}}
+		g.Nodes[name] = &Node{Name: name, X: x, Y: y, Neighbors: []*Node{}}
+		g.compact = nil
 	}
 }
 
@@ -34,155 +49,81 @@ func (g *Graph) AddEdge(from, to string) {
 	
 	if fromNode != nil && toNode != nil {
 		fromNode.Neighbors = append(fromNode.Neighbors, toNode)
+		g.compact = nil
 	}
 }
 
-func (g *Graph) PathExists(start, end string) bool {
-	if start == end {
-		return true
-	}
+// Compact returns an indexed snapshot of the graph, built on first use
+func (g *Graph) Compact() *Compact {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	
-	visited := make(map[string]bool)
-	return g.dfs(start, end, visited)
+	if g.compact == nil {
+		g.compact = compactFromGraph(g)
+	}
+	return g.compact
 }
 
-func (g *Graph) dfs(current, target string, visited map[string]bool) bool {
-	if current == target {
-		return true
-	}
-	
-	visited[current] = true
-	
-	if node, exists := g.Nodes[current]; exists {
-		for _, neighbor := range node.Neighbors {
-			if !visited[neighbor.Name] {
-				if g.dfs(neighbor.Name, target, visited) {
-					return true
-				}
-			}
-		}
-	}
-	
-	return false
+// PathExists reports whether end can be reached from start
+func (g *Graph) PathExists(start, end string) bool {
+	return g.Compact().PathExists(start, end)
 }
 
+// FindShortestPath returns a path with the fewest connections between start
+// and end, or nil if there is none
 func (g *Graph) FindShortestPath(start, end string) []string {
-	if start == end {
-		return []string{start}
-	}
-	
-	// Reset all nodes
-	for _, node := range g.Nodes {
-		node.Visited = false
-		node.Distance = -1
-		node.Parent = nil
-	}
-	
-	queue := []*Node{}
-	startNode := g.Nodes[start]
-	startNode.Distance = 0
-	startNode.Visited = true
-	queue = append(queue, startNode)
-	
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		
-		if current.Name == end {
-			// Reconstruct path
-			path := []string{}
-			for current != nil {
-				path = append([]string{current.Name}, path...)
-				current = current.Parent
-			}
-			return path
-		}
-		
-		for _, neighbor := range current.Neighbors {
-			if !neighbor.Visited {
-				neighbor.Visited = true
-				neighbor.Distance = current.Distance + 1
-				neighbor.Parent = current
-				queue = append(queue, neighbor)
-			}
-		}
-	}
-	
-	return nil
+	return g.Compact().FindShortestPath(start, end)
 }
 
+// FindMultiplePaths returns up to maxPaths loopless paths from start to end,
+// shortest first
 func (g *Graph) FindMultiplePaths(start, end string, maxPaths int) [][]string {
-	paths := [][]string{}
-	
-	// Find first shortest path
-	firstPath := g.FindShortestPath(start, end)
-	if firstPath == nil {
-		return paths
-	}
-	
-	paths = append(paths, firstPath)
-	
-	if maxPaths == 1 {
-		return paths
-	}
-	
-	// Try to find alternative paths by temporarily removing edges
-	for i := 1; i < len(firstPath)-1 && len(paths) < maxPaths; i++ {
-		// Create a copy of the graph without the edge
-		tempGraph := g.copyWithoutEdge(firstPath[i-1], firstPath[i])
-		altPath := tempGraph.FindShortestPath(start, end)
-		if altPath != nil && !pathExists(paths, altPath) {
-			paths = append(paths, altPath)
-		}
-	}
-	
-	return paths
+	return g.FindKShortestPaths(start, end, maxPaths)
 }
 
-func (g *Graph) copyWithoutEdge(from, to string) *Graph {
-	newGraph := NewGraph()
-	
-	// Copy all nodes
-	for name := range g.Nodes {
-		newGraph.AddNode(name)
-	}
-	
-	// Copy all edges except the specified one
-	for _, node := range g.Nodes {
-		for _, neighbor := range node.Neighbors {
-			if !(node.Name == from && neighbor.Name == to) {
-				newGraph.AddEdge(node.Name, neighbor.Name)
-			}
-		}
-	}
-	
-	return newGraph
-}
-
-func pathExists(paths [][]string, newPath []string) bool {
-	for _, path := range paths {
-		if len(path) == len(newPath) {
-			same := true
-			for i := range path {
-				if path[i] != newPath[i] {
-					same = false
-					break
-				}
-			}
-			if same {
-				return true
-			}
-		}
-	}
-	return false
+// FindMultiplePathsContext is FindMultiplePaths, returning a CanceledError as
+// soon as ctx is done
+func (g *Graph) FindMultiplePathsContext(ctx context.Context, start, end string, maxPaths int) ([][]string, error) {
+	return g.Compact().FindKShortestPathsContext(ctx, start, end, maxPaths, -1)
+}
+
+// FindKShortestPaths returns up to k loopless paths from start to end in
+// non-decreasing length using Yen's algorithm.
+func (g *Graph) FindKShortestPaths(start, end string, k int) [][]string {
+	return g.Compact().FindKShortestPaths(start, end, k)
+}
+
+// FindKShortestPathsWithin works like FindKShortestPaths but stops once paths
+// get more than maxDetour stations longer than the shortest one. A negative
+// maxDetour disables the cap.
+func (g *Graph) FindKShortestPathsWithin(start, end string, k, maxDetour int) [][]string {
+	return g.Compact().FindKShortestPathsWithin(start, end, k, maxDetour)
+}
+
+// FindDisjointPaths returns up to k vertex-disjoint paths from start to end
+// with minimal total length. See Compact.FindDisjointPaths.
+func (g *Graph) FindDisjointPaths(start, end string, k int) [][]string {
+	return g.Compact().FindDisjointPaths(start, end, k)
+}
+
+// FindShortestPathAStar returns a path with the fewest connections between
+// start and end using A* over station coordinates
+func (g *Graph) FindShortestPathAStar(start, end string) []string {
+	return g.Compact().FindShortestPathAStar(start, end)
+}
+
+// FindGeometricPath returns the path with the shortest straight-line track
+// length between start and end, and that length
+func (g *Graph) FindGeometricPath(start, end string) ([]string, float64) {
+	return g.Compact().FindGeometricPath(start, end)
 }
 
 func BuildGraph(network *types.Network) *Graph {
 	g := NewGraph()
 	
 	// Add all nodes
-	for name := range network.Stations {
-		g.AddNode(name)
+	for name, station := range network.Stations {
+		g.AddNodeAt(name, station.X, station.Y)
 	}
 	
 	// Add all edges
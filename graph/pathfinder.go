@@ -1,10 +1,9 @@
 package graph
 
-import (
-	"sort"
-)
+import "context"
 
-// PathFinder handles finding multiple paths in a graph
+// PathFinder handles finding multiple paths in a graph. It is safe for
+// concurrent use as long as the graph isn't modified.
 type PathFinder struct {
 	graph *Graph
 }
@@ -19,56 +18,37 @@ type Path []string
 
 // FindMultiplePaths finds multiple paths from start to end
 func (pf *PathFinder) FindMultiplePaths(start, end string, maxPaths int) []Path {
-	allPaths := pf.findAllPaths(start, end, maxPaths*2) // Find more paths than needed
-	
-	// Sort paths by length
-	sort.Slice(allPaths, func(i, j int) bool {
-		return len(allPaths[i]) < len(allPaths[j])
-	})
-	
-	// Select diverse paths
-	selectedPaths := pf.selectDiversePaths(allPaths, maxPaths)
-	
-	return selectedPaths
+	paths, _ := pf.FindMultiplePathsContext(context.Background(), start, end, maxPaths)
+	return paths
 }
 
-// findAllPaths uses DFS to find all paths up to a limit
-func (pf *PathFinder) findAllPaths(start, end string, limit int) []Path {
-	var paths []Path
-	visited := make(map[string]bool)
-	currentPath := []string{}
+// FindMultiplePathsContext is FindMultiplePaths, returning a CanceledError as
+// soon as ctx is done
+func (pf *PathFinder) FindMultiplePathsContext(ctx context.Context, start, end string, maxPaths int) ([]Path, error) {
+	allPaths, err := pf.findAllPaths(ctx, start, end, maxPaths*2) // Find more paths than needed
+	if err != nil {
+		return nil, err
+	}
 	
-	pf.dfs(start, end, visited, currentPath, &paths, limit)
+	// Select diverse paths
+	selectedPaths := pf.selectDiversePaths(allPaths, maxPaths)
 	
-	return paths
+	return selectedPaths, nil
 }
 
-// dfs performs depth-first search to find paths
-func (pf *PathFinder) dfs(current, end string, visited map[string]bool, currentPath []string, paths *[]Path, limit int) {
-	if len(*paths) >= limit {
-		return
+// findAllPaths returns up to limit loopless paths, shortest first
+func (pf *PathFinder) findAllPaths(ctx context.Context, start, end string, limit int) ([]Path, error) {
+	found, err := pf.graph.FindMultiplePathsContext(ctx, start, end, limit)
+	if err != nil {
+		return nil, err
 	}
 	
-	visited[current] = true
-	currentPath = append(currentPath, current)
-	
-	if current == end {
-		// Found a path, make a copy and add it
-		pathCopy := make([]string, len(currentPath))
-		copy(pathCopy, currentPath)
-		*paths = append(*paths, pathCopy)
-	} else {
-		// Explore neighbors
-		node := pf.graph.Nodes[current]
-		for _, neighbor := range node.Neighbors {
-			if !visited[neighbor.Name] {
-				pf.dfs(neighbor.Name, end, visited, currentPath, paths, limit)
-			}
-		}
+	var paths []Path
+	for _, path := range found {
+		paths = append(paths, path)
 	}
 	
-	// Backtrack
-	visited[current] = false
+	return paths, nil
 }
 
 // selectDiversePaths selects paths that share minimal nodes
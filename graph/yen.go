@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"container/heap"
+	"context"
+	"encoding/binary"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+// FindKShortestPaths returns up to k loopless paths from start to end in
+// non-decreasing length using Yen's algorithm.
+func (c *Compact) FindKShortestPaths(start, end string, k int) [][]string {
+	return c.FindKShortestPathsWithin(start, end, k, -1)
+}
+
+// FindKShortestPathsWithin works like FindKShortestPaths but stops once paths
+// get more than maxDetour stations longer than the shortest one. A negative
+// maxDetour disables the cap.
+func (c *Compact) FindKShortestPathsWithin(start, end string, k, maxDetour int) [][]string {
+	paths, _ := c.FindKShortestPathsContext(context.Background(), start, end, k, maxDetour)
+	return paths
+}
+
+// FindKShortestPathsContext is FindKShortestPathsWithin, returning a
+// CanceledError as soon as ctx is done
+func (c *Compact) FindKShortestPathsContext(ctx context.Context, start, end string, k, maxDetour int) ([][]string, error) {
+	if k <= 0 {
+		return nil, nil
+	}
+
+	first := c.indexPath(c.shortestPathAvoiding(start, end, nil, nil))
+	if first == nil {
+		return nil, nil
+	}
+
+	paths := [][]int32{first}
+	seen := map[string]bool{pathKey(first): true}
+	candidates := &pathHeap{}
+	limit := len(first) + maxDetour
+
+	for len(paths) < k {
+		last := paths[len(paths)-1]
+
+		// Branch off the last accepted path at every spur node
+		for i := 0; i < len(last)-1; i++ {
+			if err := errors.Canceled(ctx, "k shortest paths"); err != nil {
+				return nil, err
+			}
+			root := last[:i+1]
+
+			// Block the next edge of every accepted path sharing this root
+			blockedEdges := make(map[[2]int32]bool)
+			for _, p := range paths {
+				if len(p) > i+1 && equalPrefix(p, root) {
+					blockedEdges[[2]int32{p[i], p[i+1]}] = true
+				}
+			}
+
+			// Keep the spur path loopless by excluding the root's other nodes
+			blockedNodes := make(map[int32]bool, i)
+			for _, n := range root[:i] {
+				blockedNodes[n] = true
+			}
+
+			spurPath := c.indexPath(c.shortestPathAvoiding(c.names[last[i]], end, blockedNodes, blockedEdges))
+			if spurPath == nil {
+				continue
+			}
+
+			candidate := make([]int32, 0, len(root)+len(spurPath)-1)
+			candidate = append(candidate, root[:i]...)
+			candidate = append(candidate, spurPath...)
+
+			key := pathKey(candidate)
+			if seen[key] || (maxDetour >= 0 && len(candidate) > limit) {
+				continue
+			}
+			seen[key] = true
+			heap.Push(candidates, candidate)
+		}
+
+		if candidates.Len() == 0 {
+			break
+		}
+		paths = append(paths, heap.Pop(candidates).([]int32))
+	}
+
+	result := make([][]string, len(paths))
+	for i, p := range paths {
+		result[i] = c.pathNames(p)
+	}
+	return result, nil
+}
+
+// indexPath converts a path of station names to indices
+func (c *Compact) indexPath(path []string) []int32 {
+	if path == nil {
+		return nil
+	}
+	indices := make([]int32, len(path))
+	for i, name := range path {
+		indices[i] = c.index[name]
+	}
+	return indices
+}
+
+func equalPrefix(path, prefix []int32) bool {
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func pathKey(path []int32) string {
+	key := make([]byte, 4*len(path))
+	for i, n := range path {
+		binary.LittleEndian.PutUint32(key[4*i:], uint32(n))
+	}
+	return string(key)
+}
+
+// pathHeap orders candidate paths by length, then by their node indices
+type pathHeap [][]int32
+
+func (h pathHeap) Len() int { return len(h) }
+
+func (h pathHeap) Less(i, j int) bool {
+	if len(h[i]) != len(h[j]) {
+		return len(h[i]) < len(h[j])
+	}
+	for n := range h[i] {
+		if h[i][n] != h[j][n] {
+			return h[i][n] < h[j][n]
+		}
+	}
+	return false
+}
+
+func (h pathHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pathHeap) Push(x any) { *h = append(*h, x.([]int32)) }
+
+func (h *pathHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
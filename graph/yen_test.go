@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindKShortestPaths(t *testing.T) {
+	// Stations are indexed in name order, which breaks ties between paths
+	// of the same length
+	square := []string{"s-a", "a-t", "s-b", "b-t", "a-b"}
+
+	tests := []struct {
+		name        string
+		connections []string
+		start, end  string
+		k           int
+		maxDetour   int
+		want        [][]string
+	}{
+		{
+			name:        "all paths",
+			connections: square,
+			start:       "s", end: "t", k: 10, maxDetour: -1,
+			want: [][]string{{"s", "a", "t"}, {"s", "b", "t"}, {"s", "a", "b", "t"}, {"s", "b", "a", "t"}},
+		},
+		{
+			name:        "first k",
+			connections: square,
+			start:       "s", end: "t", k: 3, maxDetour: -1,
+			want: [][]string{{"s", "a", "t"}, {"s", "b", "t"}, {"s", "a", "b", "t"}},
+		},
+		{
+			name:        "no detour",
+			connections: square,
+			start:       "s", end: "t", k: 10, maxDetour: 0,
+			want: [][]string{{"s", "a", "t"}, {"s", "b", "t"}},
+		},
+		{
+			// The loop through d never returns to c or e
+			name:        "loopless",
+			connections: []string{"c-d", "d-e", "c-e", "e-f"},
+			start:       "c", end: "f", k: 10, maxDetour: -1,
+			want: [][]string{{"c", "e", "f"}, {"c", "d", "e", "f"}},
+		},
+		{
+			name:        "no route",
+			connections: []string{"s-a", "b-t"},
+			start:       "s", end: "t", k: 3, maxDetour: -1,
+			want: nil,
+		},
+		{
+			name:        "k is zero",
+			connections: square,
+			start:       "s", end: "t", k: 0, maxDetour: -1,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGraph(tt.connections...)
+			got := g.FindKShortestPathsWithin(tt.start, tt.end, tt.k, tt.maxDetour)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, path := range got {
+				checkPath(t, g, path, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestFindKShortestPathsOrdering(t *testing.T) {
+	g := newTestGraph("a1-a2", "a2-a3", "b1-b2", "b2-b3", "c1-c2", "c2-c3",
+		"a1-b1", "b1-c1", "a2-b2", "b2-c2", "a3-b3", "b3-c3")
+
+	paths := g.FindKShortestPaths("a1", "c3", 50)
+	seen := make(map[string]bool)
+	for i, path := range paths {
+		checkPath(t, g, path, "a1", "c3")
+		if i > 0 && len(path) < len(paths[i-1]) {
+			t.Errorf("path %d %v is shorter than the one before it", i, path)
+		}
+
+		stations := make(map[string]bool)
+		for _, station := range path {
+			if stations[station] {
+				t.Errorf("path %v visits %s twice", path, station)
+			}
+			stations[station] = true
+		}
+		if key := strings.Join(path, " "); seen[key] {
+			t.Errorf("path %v returned twice", path)
+		} else {
+			seen[key] = true
+		}
+	}
+
+	// The 6 monotone paths across the grid are the shortest
+	if len(paths) < 6 || len(paths[5]) != 5 || (len(paths) > 6 && len(paths[6]) == 5) {
+		t.Errorf("expected exactly 6 paths of 5 stations first, got %v", paths)
+	}
+}
@@ -1,32 +1,86 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
 	"gitea.kood.tech/innocentkwizera1/stations/simulation"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
 	"gitea.kood.tech/innocentkwizera1/stations/validation"
 )
 
 func main() {
-	if len(os.Args) < 5 {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := serve(os.Args[2:]); err != nil {
+			errors.PrintError(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		if err := runBatch(os.Args[2:]); err != nil {
+			errors.PrintError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	opts, args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		errors.PrintError(err)
+		os.Exit(1)
+	}
+
+	if len(args) < 4 {
 		errors.PrintError(errors.ErrTooFewArgs)
 		os.Exit(1)
 	}
-	if len(os.Args) > 5 {
+	if len(args) > 4 {
 		errors.PrintError(errors.ErrTooManyArgs)
 		os.Exit(1)
 	}
 
-	network, start, end, numTrains, err := validation.ValidateAndLoad(os.Args)
+	network, start, end, numTrains, err := validation.ValidateAndLoad(append([]string{os.Args[0]}, args...))
 	if err != nil {
 		errors.PrintError(err)
 		os.Exit(1)
 	}
 
 	simulator := simulation.NewSimulator(network, start, end, numTrains)
-	moves, err := simulator.Run()
+	if opts.reroute {
+		simulator.EnableRerouting(opts.rerouteSlack)
+	}
+	if opts.resolveDeadlocks {
+		simulator.ResolveDeadlocks(true)
+	}
+	simulator.SetMaxTurns(opts.maxTurns)
+	simulator.SetAging(opts.aging)
+	simulator.SetService(opts.service, opts.cycles)
+	var scenario *types.Scenario
+	if opts.scenario != "" {
+		scenario, err = parser.ParseScenarioFile(opts.scenario)
+		if err == nil {
+			err = simulator.SetScenario(scenario)
+		}
+		if err != nil {
+			errors.PrintError(err)
+			os.Exit(1)
+		}
+	}
+	if opts.explain {
+		simulator.AddObserver(simulation.NewExplainer(os.Stderr))
+	}
+	ctx := context.Background()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	moves, err := simulator.RunContext(ctx)
 	if err != nil {
 		errors.PrintError(err)
 		os.Exit(1)
@@ -35,4 +89,58 @@ func main() {
 	for _, move := range moves {
 		fmt.Println(move)
 	}
-}
\ No newline at end of file
+	for _, missed := range simulator.MissedDeadlines() {
+		fmt.Fprintf(os.Stderr, "Warning: %s arrived in turn %d, after its deadline of turn %d\n", missed.Train, missed.Arrived, missed.Deadline)
+	}
+
+	if scenario != nil && len(scenario.Closures) > 0 {
+		report, err := simulator.CompareToBaseline(ctx)
+		if err != nil {
+			errors.PrintError(err)
+			os.Exit(1)
+		}
+		printDelays(report)
+	}
+
+	if opts.reliability != "" {
+		reliability, err := parser.ParseReliabilityFile(opts.reliability)
+		if err != nil {
+			errors.PrintError(err)
+			os.Exit(1)
+		}
+		report, err := simulator.MonteCarlo(ctx, reliability, opts.runs, opts.seed)
+		if err != nil {
+			errors.PrintError(err)
+			os.Exit(1)
+		}
+		printReliability(report)
+	}
+}
+
+// printDelays writes the effect of the disruptions to stderr
+func printDelays(report *simulation.DelayReport) {
+	for _, delay := range report.Trains {
+		fmt.Fprintf(os.Stderr, "Delay: %s arrived in turn %d instead of %d (%+d)\n", delay.Train, delay.Arrived, delay.Baseline, delay.Delay)
+	}
+	fmt.Fprintf(os.Stderr, "Disruptions: run took %d turns instead of %d, total delay %d\n", report.Turns, report.BaselineTurns, report.TotalDelay)
+}
+
+// printReliability writes the outcome of the Monte Carlo simulation to
+// stderr
+func printReliability(report *simulation.ReliabilityReport) {
+	fmt.Fprintf(os.Stderr, "Reliability: %d runs with seed %d, %d failed, %d turns undisrupted\n", report.Runs, report.Seed, report.Failed, report.BaselineTurns)
+	fmt.Fprintf(os.Stderr, "Turns: %s\n", formatPercentiles(report.Turns))
+	for _, count := range report.Distribution {
+		fmt.Fprintf(os.Stderr, "  %d turns: %d runs\n", count.Turns, count.Runs)
+	}
+	for _, train := range report.Trains {
+		fmt.Fprintf(os.Stderr, "Delay %s: %s\n", train.Train, formatPercentiles(train.Percentiles))
+	}
+	for _, element := range report.Elements {
+		fmt.Fprintf(os.Stderr, "Failure %s: %d runs, total delay %d, mean %.2f\n", element.Element, element.Failures, element.TotalDelay, element.MeanDelay)
+	}
+}
+
+func formatPercentiles(p simulation.Percentiles) string {
+	return fmt.Sprintf("mean %.2f, p50 %d, p90 %d, p99 %d, max %d", p.Mean, p.P50, p.P90, p.P99, p.Max)
+}
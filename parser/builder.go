@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// builder applies the map rules shared by every input format
+type builder struct {
+	network *types.Network
+
+	// Using a map is a more reliable way to track existing connections
+	// to prevent duplicates like 'a-b' and 'b-a'.
+	connectionSet map[string]bool
+	coordSet      map[[2]int]bool
+	// blockedSet holds the connections already in a signal block
+	blockedSet map[string]bool
+	// terminalSet holds the stations already given a capacity
+	terminalSet map[string]bool
+}
+
+func newBuilder() *builder {
+	return &builder{
+		network:       types.NewNetwork(),
+		connectionSet: make(map[string]bool),
+		coordSet:      make(map[[2]int]bool),
+		blockedSet:    make(map[string]bool),
+		terminalSet:   make(map[string]bool),
+	}
+}
+
+// validStationName rejects names that would clash with the map syntax
+func validStationName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " ,-")
+}
+
+func (b *builder) addStation(name string, x, y int) error {
+	if !validStationName(name) {
+		return errors.ErrInvalidStationFormat
+	}
+	if x < 0 || y < 0 {
+		return errors.ErrInvalidCoords
+	}
+
+	if _, exists := b.network.Stations[name]; exists {
+		return errors.ErrDuplicateStation
+	}
+	if b.coordSet[[2]int{x, y}] {
+		return errors.ErrDuplicateCoords
+	}
+	b.coordSet[[2]int{x, y}] = true
+
+	b.network.Stations[name] = &types.Station{Name: name, X: x, Y: y}
+	if len(b.network.Stations) > 10000 {
+		return errors.ErrMapTooLarge
+	}
+	return nil
+}
+
+func (b *builder) addConnection(from, to string) error {
+	if from == "" || to == "" {
+		return errors.ErrInvalidConnection
+	}
+
+	if _, ok := b.network.Stations[from]; !ok {
+		return errors.ErrInvalidConnection
+	}
+	if _, ok := b.network.Stations[to]; !ok {
+		return errors.ErrInvalidConnection
+	}
+
+	// To check for duplicates, we create a canonical key.
+	// 'a-b' and 'b-a' will both result in the same key "a-b" if 'a' comes before 'b'.
+	key := connectionKey(from, to)
+
+	if b.connectionSet[key] {
+		return errors.ErrDuplicateConnection
+	}
+	b.connectionSet[key] = true
+
+	// Add the connection both ways to the main network struct
+	b.network.Connections[from] = append(b.network.Connections[from], to)
+	b.network.Connections[to] = append(b.network.Connections[to], from)
+	return nil
+}
+
+// connectionKey is the same for both directions of a connection
+func connectionKey(from, to string) string {
+	if from > to {
+		return to + "-" + from
+	}
+	return from + "-" + to
+}
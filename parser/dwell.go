@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+// parseDwell reads a dwell: line, "name,turns"
+func (b *builder) parseDwell(line string) error {
+	name, turnsStr, found := strings.Cut(line, ",")
+	turns, err := strconv.Atoi(strings.TrimSpace(turnsStr))
+	if !found || err != nil {
+		return errors.ErrInvalidDwell
+	}
+	return b.setDwell(strings.TrimSpace(name), turns)
+}
+
+// setDwell sets the dwell time of a station added before
+func (b *builder) setDwell(name string, turns int) error {
+	station, ok := b.network.Stations[name]
+	if !ok || turns < 0 {
+		return errors.ErrInvalidDwell
+	}
+	station.Dwell = turns
+	return nil
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"encoding/json"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// JSONMap is the JSON form of a map file
+type JSONMap struct {
+	Stations []struct {
+		Name     string `json:"name"`
+		X        int    `json:"x"`
+		Y        int    `json:"y"`
+		Dwell    int    `json:"dwell,omitempty"`
+		Capacity int    `json:"capacity,omitempty"`
+		Depot    bool   `json:"depot,omitempty"`
+	} `json:"stations"`
+	Connections []jsonConnection `json:"connections"`
+	Headway     *struct {
+		Stations int `json:"stations"`
+		Turns    int `json:"turns"`
+	} `json:"headway,omitempty"`
+	Blocks []struct {
+		Name        string           `json:"name"`
+		Connections []jsonConnection `json:"connections"`
+	} `json:"blocks,omitempty"`
+}
+
+type jsonConnection struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ParseJSON reads a map in the JSON format, applying the same rules as Parse
+func ParseJSON(data []byte) (*types.Network, error) {
+	var m JSONMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if m.Stations == nil || m.Connections == nil {
+		return nil, errors.ErrMissingSections
+	}
+
+	b := newBuilder()
+	for _, s := range m.Stations {
+		if err := b.addStation(s.Name, s.X, s.Y); err != nil {
+			return nil, err
+		}
+		if err := b.setDwell(s.Name, s.Dwell); err != nil {
+			return nil, err
+		}
+		if s.Capacity != 0 || s.Depot {
+			if err := b.setCapacity(s.Name, s.Capacity, s.Depot); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, c := range m.Connections {
+		if err := b.addConnection(c.From, c.To); err != nil {
+			return nil, err
+		}
+	}
+	if m.Headway != nil {
+		if err := b.setHeadway("stations", m.Headway.Stations); err != nil {
+			return nil, err
+		}
+		if err := b.setHeadway("turns", m.Headway.Turns); err != nil {
+			return nil, err
+		}
+	}
+	for _, block := range m.Blocks {
+		signalBlock := types.SignalBlock{Name: block.Name}
+		for _, c := range block.Connections {
+			signalBlock.Connections = append(signalBlock.Connections, [2]string{c.From, c.To})
+		}
+		if err := b.addSignalBlock(signalBlock); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.network, nil
+}
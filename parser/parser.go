@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -17,17 +18,17 @@ func ParseFile(path string) (*types.Network, error) {
 	}
 	defer file.Close()
 
-	network := types.NewNetwork()
-	scanner := bufio.NewScanner(file)
+	return Parse(file)
+}
+
+// Parse reads a map in the text format from r
+func Parse(r io.Reader) (*types.Network, error) {
+	b := newBuilder()
+	scanner := bufio.NewScanner(r)
 	hasStations := false
 	hasConnections := false
-	inStations := false
-	inConnections := false
+	section := ""
 	lineNum := 0
-	
-	// Using a map is a more reliable way to track existing connections
-	// to prevent duplicates like 'a-b' and 'b-a'.
-	connectionSet := make(map[string]bool)
 
 	for scanner.Scan() {
 		lineNum++
@@ -39,54 +40,46 @@ func ParseFile(path string) (*types.Network, error) {
 			line = strings.TrimSpace(line[:idx])
 		}
 
-		if line == "stations:" {
+		// The optional dwell:, capacity: and depots: sections follow
+		// stations:, and headway: and blocks: follow connections:
+		switch line {
+		case "stations:":
 			hasStations = true
-			inStations = true
-			inConnections = false
+			section = line
 			continue
-		}
-		if line == "connections:" {
+		case "connections:":
 			hasConnections = true
-			inStations = false
-			inConnections = true
+			section = line
+			continue
+		case "dwell:", "capacity:", "depots:", "headway:", "blocks:":
+			section = line
 			continue
 		}
 
-		if inStations {
+		if section == "stations:" {
 			parts := strings.Split(line, ",")
 			if len(parts) != 3 {
 				return nil, errors.ErrInvalidStationFormat
 			}
 
 			name := strings.TrimSpace(parts[0])
-			if name == "" || strings.ContainsAny(name, " ,-") { // Stricter name validation
-				return nil, errors.ErrInvalidStationFormat 
-			}
 			xStr := strings.TrimSpace(parts[1])
 			yStr := strings.TrimSpace(parts[2])
 
 			x, errX := strconv.Atoi(xStr)
 			y, errY := strconv.Atoi(yStr)
 
-			if errX != nil || errY != nil || x < 0 || y < 0 {
-				return nil, errors.ErrInvalidCoords
-			}
-
-			if _, exists := network.Stations[name]; exists {
-				return nil, errors.ErrDuplicateStation
+			if !validStationName(name) {
+				return nil, errors.ErrInvalidStationFormat
 			}
-
-			for _, s := range network.Stations {
-				if s.X == x && s.Y == y {
-					return nil, errors.ErrDuplicateCoords
-				}
+			if errX != nil || errY != nil {
+				return nil, errors.ErrInvalidCoords
 			}
 
-			network.Stations[name] = &types.Station{Name: name, X: x, Y: y}
-			if len(network.Stations) > 10000 {
-				return nil, errors.ErrMapTooLarge
+			if err := b.addStation(name, x, y); err != nil {
+				return nil, err
 			}
-		} else if inConnections {
+		} else if section == "connections:" {
 			parts := strings.Split(line, "-")
 			if len(parts) != 2 {
 				return nil, errors.ErrInvalidConnection
@@ -95,33 +88,26 @@ func ParseFile(path string) (*types.Network, error) {
 			from := strings.TrimSpace(parts[0])
 			to := strings.TrimSpace(parts[1])
 
-			if from == "" || to == "" {
-				return nil, errors.ErrInvalidConnection
+			if err := b.addConnection(from, to); err != nil {
+				return nil, err
 			}
 
-			if _, ok := network.Stations[from]; !ok {
-				return nil, errors.ErrInvalidConnection
+		} else if section == "dwell:" {
+			if err := b.parseDwell(line); err != nil {
+				return nil, err
 			}
-			if _, ok := network.Stations[to]; !ok {
-				return nil, errors.ErrInvalidConnection
+		} else if section == "capacity:" || section == "depots:" {
+			if err := b.parseCapacity(line, section == "depots:"); err != nil {
+				return nil, err
 			}
-
-			// To check for duplicates, we create a canonical key.
-			// 'a-b' and 'b-a' will both result in the same key "a-b" if 'a' comes before 'b'.
-			key := from + "-" + to
-			if from > to {
-				key = to + "-" + from
+		} else if section == "headway:" {
+			if err := b.parseHeadway(line); err != nil {
+				return nil, err
 			}
-
-			if connectionSet[key] {
-				return nil, errors.ErrDuplicateConnection
+		} else if section == "blocks:" {
+			if err := b.parseSignalBlock(line); err != nil {
+				return nil, err
 			}
-			connectionSet[key] = true
-
-			// Add the connection both ways to the main network struct
-			network.Connections[from] = append(network.Connections[from], to)
-			network.Connections[to] = append(network.Connections[to], from)
-
 		} else if hasStations && hasConnections {
 			// Ignore lines that might be after the main sections
 			continue
@@ -136,5 +122,5 @@ func ParseFile(path string) (*types.Network, error) {
 	if !hasStations || !hasConnections {
 		return nil, errors.ErrMissingSections
 	}
-	return network, nil
+	return b.network, nil
 }
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// ParseReliabilityFile reads failure probabilities from the file at path
+func ParseReliabilityFile(path string) (*types.Reliability, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseReliability(file)
+}
+
+// ParseReliability reads failure probabilities from r. The failures:
+// section holds one track or station per line with the chance that it fails
+// in a run, and optionally how many turns a failure lasts:
+//
+//	failures:
+//	a-b 0.05
+//	station x 0.01 for 8 turns
+//
+// Failures last types.DefaultFailureTurns turns unless given.
+func ParseReliability(r io.Reader) (*types.Reliability, error) {
+	reliability := &types.Reliability{}
+	scanner := bufio.NewScanner(r)
+	inSection := false
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if line == "failures:" {
+			inSection = true
+			continue
+		}
+		if !inSection {
+			return nil, reliabilityError(lineNum, "expected a failures: section")
+		}
+		failure, err := parseFailure(line)
+		if err != nil {
+			return nil, reliabilityError(lineNum, err.Error())
+		}
+		reliability.Failures = append(reliability.Failures, failure)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return reliability, nil
+}
+
+// parseFailure reads "a-b 0.05" or "station x 0.01 for 8 turns"; the word
+// turns is optional
+func parseFailure(line string) (types.Failure, error) {
+	failure := types.Failure{Turns: types.DefaultFailureTurns}
+	fields := []string{}
+	for _, field := range strings.Fields(line) {
+		if field != "turns" {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return failure, fmt.Errorf("expected a track or station in %q", line)
+	}
+
+	rest := fields
+	if rest[0] == "station" && len(rest) > 1 {
+		failure.Station, rest = rest[1], rest[2:]
+	} else {
+		from, to, found := strings.Cut(rest[0], "-")
+		if !found || from == "" || to == "" {
+			return failure, fmt.Errorf("invalid track %q", rest[0])
+		}
+		failure.Track, rest = [2]string{from, to}, rest[1:]
+	}
+
+	if len(rest) != 1 && (len(rest) != 3 || rest[1] != "for") {
+		return failure, fmt.Errorf("expected <probability> [for <turns>] in %q", line)
+	}
+	var err error
+	if failure.Probability, err = strconv.ParseFloat(rest[0], 64); err != nil || !(failure.Probability >= 0 && failure.Probability <= 1) {
+		return failure, fmt.Errorf("probability must be between 0 and 1, got %q", rest[0])
+	}
+	if len(rest) == 3 {
+		if failure.Turns, err = strconv.Atoi(rest[2]); err != nil || failure.Turns < 1 {
+			return failure, fmt.Errorf("failure must last at least one turn, got %q", rest[2])
+		}
+	}
+	return failure, nil
+}
+
+func reliabilityError(lineNum int, msg string) error {
+	return fmt.Errorf("%w: line %d: %s", errors.ErrInvalidReliability, lineNum, msg)
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	stderrors "errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+func TestParseReliability(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []types.Failure
+	}{
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:  "empty section",
+			input: "failures:\n",
+		},
+		{
+			name:  "track",
+			input: "failures:\na-b 0.05\n",
+			want:  []types.Failure{{Track: [2]string{"a", "b"}, Probability: 0.05, Turns: types.DefaultFailureTurns}},
+		},
+		{
+			name:  "station for some turns",
+			input: "failures:\nstation x 0.01 for 8 turns\n",
+			want:  []types.Failure{{Station: "x", Probability: 0.01, Turns: 8}},
+		},
+		{
+			name:  "without the word turns",
+			input: "failures:\nstation x 1 for 3\n",
+			want:  []types.Failure{{Station: "x", Probability: 1, Turns: 3}},
+		},
+		{
+			name:  "blank lines and comments",
+			input: "# failures seen last year\n\nfailures:\n\n  a-b 0 # never\n\t\nc-d 0.5 for 2 turns\n",
+			want: []types.Failure{
+				{Track: [2]string{"a", "b"}, Turns: types.DefaultFailureTurns},
+				{Track: [2]string{"c", "d"}, Probability: 0.5, Turns: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reliability, err := ParseReliability(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reliability.Failures, tt.want) {
+				t.Errorf("got %+v, want %+v", reliability.Failures, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReliabilityErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"no section", "a-b 0.05\n"},
+		{"only the word turns", "failures:\nturns\n"},
+		{"no probability", "failures:\na-b\n"},
+		{"NaN", "failures:\na-b NaN\n"},
+		{"negative probability", "failures:\na-b -0.1\n"},
+		{"probability above one", "failures:\nstation x 1.5\n"},
+		{"infinite probability", "failures:\na-b +Inf\n"},
+		{"probability not a number", "failures:\na-b often\n"},
+		{"malformed track", "failures:\nab 0.1\n"},
+		{"track without an end", "failures:\na- 0.1\n"},
+		{"station without a name", "failures:\nstation 0.1\n"},
+		{"zero turns", "failures:\na-b 0.1 for 0 turns\n"},
+		{"turns not a number", "failures:\na-b 0.1 for ever\n"},
+		{"for without turns", "failures:\na-b 0.1 for\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseReliability(strings.NewReader(tt.input))
+			if !stderrors.Is(err, errors.ErrInvalidReliability) {
+				t.Errorf("error %v, want %v", err, errors.ErrInvalidReliability)
+			}
+		})
+	}
+}
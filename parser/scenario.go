@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// ParseScenarioFile reads a scenario from the file at path
+func ParseScenarioFile(path string) (*types.Scenario, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseScenario(file)
+}
+
+// ParseScenario reads a scenario from r. The trains: section holds one rule
+// per line: the trains it applies to (T3, a range T2-T5, or * for all)
+// followed by comma separated settings, e.g.
+//
+//	trains:
+//	*,depart=1
+//	T2-T5,depart=3,deadline=12
+//	T6,class=express
+//	T7,class=freight,speed=1/3
+//	T8,priority=10,dwell=1
+//	T9,class=freight,length=3
+//
+// A speed is given in tracks per turn, or as 1/n for a train needing n turns
+// per track. The disruptions: section closes tracks or stations:
+//
+//	disruptions:
+//	close a-b from turn 5 to 12
+//	close station x at turn 8
+func ParseScenario(r io.Reader) (*types.Scenario, error) {
+	scenario := &types.Scenario{}
+	scanner := bufio.NewScanner(r)
+	section := ""
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		switch line {
+		case "trains:", "disruptions:":
+			section = line
+			continue
+		}
+		if section == "" {
+			return nil, scenarioError(lineNum, "expected a trains: or disruptions: section")
+		}
+		if section == "disruptions:" {
+			closure, err := parseClosure(line)
+			if err != nil {
+				return nil, scenarioError(lineNum, err.Error())
+			}
+			scenario.Closures = append(scenario.Closures, closure)
+			continue
+		}
+
+		parts := strings.Split(line, ",")
+		rule := types.TrainRule{}
+		first, last, ok := parseTrainRange(strings.TrimSpace(parts[0]))
+		if !ok {
+			return nil, scenarioError(lineNum, fmt.Sprintf("invalid trains %q", parts[0]))
+		}
+		rule.First, rule.Last = first, last
+
+		for _, part := range parts[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+			if !found {
+				return nil, scenarioError(lineNum, fmt.Sprintf("setting %q is not key=value", part))
+			}
+			if err := setTrainSetting(&rule.Settings, strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+				return nil, scenarioError(lineNum, err.Error())
+			}
+		}
+		scenario.Rules = append(scenario.Rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+// parseClosure reads "close a-b from turn 5 to 12" or "close station x at
+// turn 8"; the word turn is optional
+func parseClosure(line string) (types.Closure, error) {
+	var closure types.Closure
+	fields := []string{}
+	for _, field := range strings.Fields(line) {
+		if field != "turn" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) < 2 || fields[0] != "close" {
+		return closure, fmt.Errorf("expected close <a-b> or close station <name>, got %q", line)
+	}
+
+	rest := fields[1:]
+	if rest[0] == "station" && len(rest) > 1 {
+		closure.Station, rest = rest[1], rest[2:]
+	} else {
+		from, to, found := strings.Cut(rest[0], "-")
+		if !found || from == "" || to == "" {
+			return closure, fmt.Errorf("invalid track %q", rest[0])
+		}
+		closure.Track, rest = [2]string{from, to}, rest[1:]
+	}
+
+	var err error
+	switch {
+	case len(rest) == 2 && rest[0] == "at":
+		err = setClosureTurns(&closure, rest[1], "")
+	case len(rest) == 4 && rest[0] == "from" && rest[2] == "to":
+		err = setClosureTurns(&closure, rest[1], rest[3])
+	default:
+		err = fmt.Errorf("expected at <turn> or from <turn> to <turn> in %q", line)
+	}
+	return closure, err
+}
+
+func setClosureTurns(closure *types.Closure, from, to string) error {
+	var err error
+	if closure.From, err = strconv.Atoi(from); err != nil || closure.From < 1 {
+		return fmt.Errorf("closure must start at a turn from 1, got %q", from)
+	}
+	if to == "" {
+		return nil
+	}
+	if closure.To, err = strconv.Atoi(to); err != nil || closure.To < closure.From {
+		return fmt.Errorf("closure must end at a turn from %d, got %q", closure.From, to)
+	}
+	return nil
+}
+
+// parseTrainRange reads "*", "T3" or "T2-T5"
+func parseTrainRange(s string) (int, int, bool) {
+	if s == "*" {
+		return 0, 0, true
+	}
+
+	from, to, isRange := strings.Cut(s, "-")
+	first, ok := parseTrainName(from)
+	if !ok {
+		return 0, 0, false
+	}
+	if !isRange {
+		return first, first, true
+	}
+	last, ok := parseTrainName(to)
+	if !ok || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+func parseTrainName(s string) (int, bool) {
+	if !strings.HasPrefix(s, "T") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(s[1:])
+	return id, err == nil && id > 0
+}
+
+// setTrainSetting stores one key=value setting of a rule
+func setTrainSetting(settings *types.TrainSettings, key, value string) error {
+	switch key {
+	case "depart":
+		return setTurn(&settings.Depart, key, value)
+	case "deadline":
+		return setTurn(&settings.Deadline, key, value)
+	case "dwell":
+		return setTurn(&settings.Dwell, key, value)
+	case "length":
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 {
+			return fmt.Errorf("length must be a number of stations, got %q", value)
+		}
+		settings.Length = &length
+		return nil
+	case "class":
+		class, ok := types.ParseTrainClass(value)
+		if !ok {
+			return fmt.Errorf("unknown class %q", value)
+		}
+		settings.Class = &class
+		return nil
+	case "speed":
+		speed, ok := parseSpeed(value)
+		if !ok {
+			return fmt.Errorf("speed must be tracks per turn or 1/turns, got %q", value)
+		}
+		settings.Speed = &speed
+		return nil
+	case "priority":
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("priority must be a number, got %q", value)
+		}
+		settings.Priority = &priority
+		return nil
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+}
+
+// setTurn parses a non-negative turn number
+func setTurn(field **int, key, value string) error {
+	turn, err := strconv.Atoi(value)
+	if err != nil || turn < 0 {
+		return fmt.Errorf("%s must be a turn number, got %q", key, value)
+	}
+	*field = &turn
+	return nil
+}
+
+// parseSpeed reads "2" (tracks per turn) or "1/3" (turns per track)
+func parseSpeed(s string) (types.Speed, bool) {
+	if num, den, isFraction := strings.Cut(s, "/"); isFraction {
+		turns, err := strconv.Atoi(den)
+		if num != "1" || err != nil || turns < 1 {
+			return types.Speed{}, false
+		}
+		return types.Speed{Turns: turns}, true
+	}
+	tracks, err := strconv.Atoi(s)
+	if err != nil || tracks < 1 {
+		return types.Speed{}, false
+	}
+	return types.Speed{Tracks: tracks}, true
+}
+
+func scenarioError(lineNum int, msg string) error {
+	return fmt.Errorf("%w: line %d: %s", errors.ErrInvalidScenario, lineNum, msg)
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	stderrors "errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestParseScenario(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *types.Scenario
+	}{
+		{
+			name:  "empty",
+			input: "# nothing yet\n\n",
+			want:  &types.Scenario{},
+		},
+		{
+			name: "train rules",
+			input: "trains:\n" +
+				"*,depart=1\n" +
+				"T2-T5, depart=3, deadline=12  # peak\n" +
+				"T6,class=express\n" +
+				"T7,class=freight,speed=1/3\n" +
+				"T8,priority=10,dwell=1,speed=2\n" +
+				"T9,length=3,deadline=0\n",
+			want: &types.Scenario{Rules: []types.TrainRule{
+				{First: 0, Last: 0, Settings: types.TrainSettings{Depart: ptr(1)}},
+				{First: 2, Last: 5, Settings: types.TrainSettings{Depart: ptr(3), Deadline: ptr(12)}},
+				{First: 6, Last: 6, Settings: types.TrainSettings{Class: ptr(types.Express)}},
+				{First: 7, Last: 7, Settings: types.TrainSettings{Class: ptr(types.Freight), Speed: &types.Speed{Turns: 3}}},
+				{First: 8, Last: 8, Settings: types.TrainSettings{Priority: ptr(10), Dwell: ptr(1), Speed: &types.Speed{Tracks: 2}}},
+				{First: 9, Last: 9, Settings: types.TrainSettings{Length: ptr(3), Deadline: ptr(0)}},
+			}},
+		},
+		{
+			name:  "train without settings",
+			input: "trains:\nT4\n",
+			want:  &types.Scenario{Rules: []types.TrainRule{{First: 4, Last: 4}}},
+		},
+		{
+			name: "closures",
+			input: "disruptions:\n" +
+				"close a-b from turn 5 to 12\n" +
+				"close station x at turn 8\n" +
+				"close b-c from 2 to 2\n" +
+				"close station y at 1\n",
+			want: &types.Scenario{Closures: []types.Closure{
+				{Track: [2]string{"a", "b"}, From: 5, To: 12},
+				{Station: "x", From: 8},
+				{Track: [2]string{"b", "c"}, From: 2, To: 2},
+				{Station: "y", From: 1},
+			}},
+		},
+		{
+			name:  "both sections, twice",
+			input: "trains:\nT1,depart=2\ndisruptions:\nclose a-b at turn 3\ntrains:\nT2,depart=4\n",
+			want: &types.Scenario{
+				Rules: []types.TrainRule{
+					{First: 1, Last: 1, Settings: types.TrainSettings{Depart: ptr(2)}},
+					{First: 2, Last: 2, Settings: types.TrainSettings{Depart: ptr(4)}},
+				},
+				Closures: []types.Closure{{Track: [2]string{"a", "b"}, From: 3}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScenario(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"no section", "T1,depart=2\n", "line 1: expected a trains: or disruptions: section"},
+		{"bad train", "trains:\nX1,depart=2\n", `line 2: invalid trains "X1"`},
+		{"train zero", "trains:\nT0\n", `invalid trains "T0"`},
+		{"reversed range", "trains:\nT5-T2\n", `invalid trains "T5-T2"`},
+		{"not key=value", "trains:\nT1,fast\n", `setting "fast" is not key=value`},
+		{"unknown setting", "trains:\nT1,colour=red\n", `unknown setting "colour"`},
+		{"negative departure", "trains:\n\nT1,depart=-1\n", "line 3: depart must be a turn number"},
+		{"bad deadline", "trains:\nT1,deadline=soon\n", "deadline must be a turn number"},
+		{"bad dwell", "trains:\nT1,dwell=x\n", "dwell must be a turn number"},
+		{"zero length", "trains:\nT1,length=0\n", "length must be a number of stations"},
+		{"unknown class", "trains:\nT1,class=tram\n", `unknown class "tram"`},
+		{"zero speed", "trains:\nT1,speed=0\n", "speed must be tracks per turn or 1/turns"},
+		{"fraction speed", "trains:\nT1,speed=2/3\n", "speed must be tracks per turn or 1/turns"},
+		{"bad priority", "trains:\nT1,priority=high\n", "priority must be a number"},
+		{"not a closure", "disruptions:\nopen a-b at turn 2\n", "line 2: expected close <a-b> or close station <name>"},
+		{"bad track", "disruptions:\nclose ab at turn 2\n", `invalid track "ab"`},
+		{"missing turns", "disruptions:\nclose a-b\n", "expected at <turn> or from <turn> to <turn>"},
+		{"turn zero", "disruptions:\nclose station x at turn 0\n", "closure must start at a turn from 1"},
+		{"ends before it starts", "disruptions:\nclose a-b from turn 5 to 4\n", "closure must end at a turn from 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScenario(strings.NewReader(tt.input))
+			if !stderrors.Is(err, errors.ErrInvalidScenario) {
+				t.Fatalf("error %v, want %v", err, errors.ErrInvalidScenario)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// parseHeadway reads a headway: line, "stations=N" or "turns=N"
+func (b *builder) parseHeadway(line string) error {
+	key, value, found := strings.Cut(line, "=")
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if !found || err != nil {
+		return errors.ErrInvalidHeadway
+	}
+	return b.setHeadway(strings.TrimSpace(key), n)
+}
+
+func (b *builder) setHeadway(key string, n int) error {
+	if n < 0 {
+		return errors.ErrInvalidHeadway
+	}
+	switch key {
+	case "stations":
+		b.network.Signalling.HeadwayStations = n
+	case "turns":
+		b.network.Signalling.HeadwayTurns = n
+	default:
+		return errors.ErrInvalidHeadway
+	}
+	return nil
+}
+
+// parseSignalBlock reads a blocks: line, a block name followed by the
+// connections it covers, e.g. "north,a-b,b-c"
+func (b *builder) parseSignalBlock(line string) error {
+	parts := strings.Split(line, ",")
+	block := types.SignalBlock{Name: strings.TrimSpace(parts[0])}
+	for _, part := range parts[1:] {
+		from, to, found := strings.Cut(strings.TrimSpace(part), "-")
+		if !found {
+			return errors.ErrInvalidSignalBlock
+		}
+		block.Connections = append(block.Connections, [2]string{strings.TrimSpace(from), strings.TrimSpace(to)})
+	}
+	return b.addSignalBlock(block)
+}
+
+// addSignalBlock adds a block of connections added before. The connections
+// of a block must form one stretch of line, and each belongs to at most one
+// block.
+func (b *builder) addSignalBlock(block types.SignalBlock) error {
+	if !validStationName(block.Name) || len(block.Connections) == 0 || !connected(block.Connections) {
+		return errors.ErrInvalidSignalBlock
+	}
+	for _, other := range b.network.Signalling.Blocks {
+		if other.Name == block.Name {
+			return errors.ErrInvalidSignalBlock
+		}
+	}
+
+	for _, conn := range block.Connections {
+		key := connectionKey(conn[0], conn[1])
+		if !b.connectionSet[key] || b.blockedSet[key] {
+			return errors.ErrInvalidSignalBlock
+		}
+		b.blockedSet[key] = true
+	}
+	b.network.Signalling.Blocks = append(b.network.Signalling.Blocks, block)
+	return nil
+}
+
+// connected reports whether the connections link up into one piece
+func connected(conns [][2]string) bool {
+	reached := map[string]bool{conns[0][0]: true}
+	for grew := true; grew; {
+		grew = false
+		for _, conn := range conns {
+			if reached[conn[0]] != reached[conn[1]] {
+				reached[conn[0]], reached[conn[1]] = true, true
+				grew = true
+			}
+		}
+	}
+	for _, conn := range conns {
+		if !reached[conn[0]] {
+			return false
+		}
+	}
+	return true
+}
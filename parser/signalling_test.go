@@ -0,0 +1,122 @@
+package parser
+
+import (
+	stderrors "errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// lineMap is a line a-b-c-d with a branch from b to e
+const lineMap = "stations:\na,0,0\nb,1,0\nc,2,0\nd,3,0\ne,1,1\n\nconnections:\na-b\nb-c\nc-d\nb-e\n\n"
+
+func TestParseSignalling(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  types.Signalling
+	}{
+		{
+			name:  "none",
+			input: lineMap,
+		},
+		{
+			name:  "headway",
+			input: lineMap + "headway:\nstations=2\n turns = 1 # after each train\n",
+			want:  types.Signalling{HeadwayStations: 2, HeadwayTurns: 1},
+		},
+		{
+			name:  "blocks",
+			input: lineMap + "blocks:\nnorth,a-b,b-c\nsouth, d-c\n",
+			want: types.Signalling{Blocks: []types.SignalBlock{
+				{Name: "north", Connections: [][2]string{{"a", "b"}, {"b", "c"}}},
+				{Name: "south", Connections: [][2]string{{"d", "c"}}},
+			}},
+		},
+		{
+			name:  "block around a junction",
+			input: lineMap + "blocks:\njunction,b-e,a-b,c-b\nheadway:\nturns=2\n",
+			want: types.Signalling{HeadwayTurns: 2, Blocks: []types.SignalBlock{
+				{Name: "junction", Connections: [][2]string{{"b", "e"}, {"a", "b"}, {"c", "b"}}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(network.Signalling, tt.want) {
+				t.Errorf("got %+v, want %+v", network.Signalling, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSignallingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"headway without value", lineMap + "headway:\nstations\n", errors.ErrInvalidHeadway},
+		{"headway not a number", lineMap + "headway:\nturns=two\n", errors.ErrInvalidHeadway},
+		{"negative headway", lineMap + "headway:\nstations=-1\n", errors.ErrInvalidHeadway},
+		{"unknown headway", lineMap + "headway:\nmetres=200\n", errors.ErrInvalidHeadway},
+		{"block without connections", lineMap + "blocks:\nnorth\n", errors.ErrInvalidSignalBlock},
+		{"block with a bad name", lineMap + "blocks:\nno-rth,a-b\n", errors.ErrInvalidSignalBlock},
+		{"malformed connection", lineMap + "blocks:\nnorth,ab\n", errors.ErrInvalidSignalBlock},
+		{"unknown connection", lineMap + "blocks:\nnorth,a-c\n", errors.ErrInvalidSignalBlock},
+		{"disjoint connections", lineMap + "blocks:\nnorth,a-b,c-d\n", errors.ErrInvalidSignalBlock},
+		{"connection in two blocks", lineMap + "blocks:\nnorth,a-b\nsouth,b-a\n", errors.ErrInvalidSignalBlock},
+		{"duplicate block", lineMap + "blocks:\nnorth,a-b\nnorth,c-d\n", errors.ErrInvalidSignalBlock},
+		{"block before its connections", "stations:\na,0,0\nb,1,0\nblocks:\nnorth,a-b\nconnections:\na-b\n", errors.ErrInvalidSignalBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			if !stderrors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseJSONSignalling(t *testing.T) {
+	text, err := Parse(strings.NewReader(lineMap + "headway:\nstations=1\nturns=2\n\nblocks:\nnorth,a-b,b-c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ParseJSON([]byte(`{
+		"stations": [
+			{"name": "a", "x": 0, "y": 0}, {"name": "b", "x": 1, "y": 0}, {"name": "c", "x": 2, "y": 0},
+			{"name": "d", "x": 3, "y": 0}, {"name": "e", "x": 1, "y": 1}
+		],
+		"connections": [
+			{"from": "a", "to": "b"}, {"from": "b", "to": "c"}, {"from": "c", "to": "d"}, {"from": "b", "to": "e"}
+		],
+		"headway": {"stations": 1, "turns": 2},
+		"blocks": [{"name": "north", "connections": [{"from": "a", "to": "b"}, {"from": "b", "to": "c"}]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON.Signalling, text.Signalling) {
+		t.Errorf("JSON map has signalling %+v, text map %+v", fromJSON.Signalling, text.Signalling)
+	}
+
+	_, err = ParseJSON([]byte(`{
+		"stations": [{"name": "a", "x": 0, "y": 0}, {"name": "b", "x": 1, "y": 0}],
+		"connections": [{"from": "a", "to": "b"}],
+		"headway": {"stations": -1}
+	}`))
+	if !stderrors.Is(err, errors.ErrInvalidHeadway) {
+		t.Errorf("negative JSON headway: error %v, want %v", err, errors.ErrInvalidHeadway)
+	}
+}
@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+// parseCapacity reads a capacity: or depots: line, "name,trains"
+func (b *builder) parseCapacity(line string, depot bool) error {
+	name, trainsStr, found := strings.Cut(line, ",")
+	trains, err := strconv.Atoi(strings.TrimSpace(trainsStr))
+	if !found || err != nil {
+		return errors.ErrInvalidCapacity
+	}
+	return b.setCapacity(strings.TrimSpace(name), trains, depot)
+}
+
+// setCapacity sets how many trains a station added before holds as a
+// terminal, and whether it is a depot. Each station is given a capacity at
+// most once.
+func (b *builder) setCapacity(name string, trains int, depot bool) error {
+	station, ok := b.network.Stations[name]
+	if !ok || trains < 1 || b.terminalSet[name] {
+		return errors.ErrInvalidCapacity
+	}
+	b.terminalSet[name] = true
+	station.Capacity = trains
+	station.Depot = depot
+	return nil
+}
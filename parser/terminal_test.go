@@ -0,0 +1,109 @@
+package parser
+
+import (
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+func TestParseCapacity(t *testing.T) {
+	type terminal struct {
+		capacity int
+		depot    bool
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]terminal
+	}{
+		{
+			name:  "none",
+			input: lineMap,
+			want:  map[string]terminal{},
+		},
+		{
+			name:  "capacity",
+			input: lineMap + "capacity:\na,2\n d , 1 # platform\n",
+			want:  map[string]terminal{"a": {capacity: 2}, "d": {capacity: 1}},
+		},
+		{
+			name:  "depots",
+			input: lineMap + "depots:\na,10\n",
+			want:  map[string]terminal{"a": {capacity: 10, depot: true}},
+		},
+		{
+			name:  "both",
+			input: lineMap + "capacity:\nd,1\n\ndepots:\na,4\n",
+			want:  map[string]terminal{"a": {capacity: 4, depot: true}, "d": {capacity: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, station := range network.Stations {
+				if got := (terminal{station.Capacity, station.Depot}); got != tt.want[name] {
+					t.Errorf("%s: got %+v, want %+v", name, got, tt.want[name])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCapacityErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown station", lineMap + "capacity:\nz,2\n"},
+		{"zero", lineMap + "capacity:\na,0\n"},
+		{"negative", lineMap + "depots:\na,-3\n"},
+		{"not a number", lineMap + "capacity:\na,two\n"},
+		{"no count", lineMap + "depots:\na\n"},
+		{"before the station", "capacity:\na,2\nstations:\na,0,0\nb,1,0\nconnections:\na-b\n"},
+		{"twice", lineMap + "capacity:\na,2\na,3\n"},
+		{"capacity and depot", lineMap + "capacity:\na,2\ndepots:\na,2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			if !stderrors.Is(err, errors.ErrInvalidCapacity) {
+				t.Errorf("error %v, want %v", err, errors.ErrInvalidCapacity)
+			}
+		})
+	}
+}
+
+func TestParseJSONCapacity(t *testing.T) {
+	network, err := ParseJSON([]byte(`{
+		"stations": [
+			{"name": "a", "x": 0, "y": 0, "capacity": 3, "depot": true},
+			{"name": "b", "x": 1, "y": 0},
+			{"name": "c", "x": 2, "y": 0, "capacity": 1}
+		],
+		"connections": [{"from": "a", "to": "b"}, {"from": "b", "to": "c"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := network.Stations["a"], network.Stations["b"], network.Stations["c"]
+	if a.Capacity != 3 || !a.Depot || b.Capacity != 0 || b.Depot || c.Capacity != 1 || c.Depot {
+		t.Errorf("got a %d/%v, b %d/%v, c %d/%v", a.Capacity, a.Depot, b.Capacity, b.Depot, c.Capacity, c.Depot)
+	}
+
+	for _, station := range []string{
+		`{"name": "a", "x": 0, "y": 0, "capacity": -1}`,
+		`{"name": "a", "x": 0, "y": 0, "depot": true}`,
+	} {
+		_, err := ParseJSON([]byte(`{"stations": [` + station + `, {"name": "b", "x": 1, "y": 0}], "connections": [{"from": "a", "to": "b"}]}`))
+		if !stderrors.Is(err, errors.ErrInvalidCapacity) {
+			t.Errorf("%s: error %v, want %v", station, err, errors.ErrInvalidCapacity)
+		}
+	}
+}
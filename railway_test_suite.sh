@@ -499,14 +499,14 @@ EOF
     # Tricky Case 5: Ring topology
     cat > test_maps/ring.map << 'EOF'
 stations:
-r1,0,0
-r2,3,0
-r3,5,2
-r4,5,5
-r5,3,7
-r6,0,7
-r7,-2,5
-r8,-2,2
+r1,2,0
+r2,5,0
+r3,7,2
+r4,7,5
+r5,5,7
+r6,2,7
+r7,0,5
+r8,0,2
 
 connections:
 r1-r2
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gitea.kood.tech/innocentkwizera1/stations/server"
+)
+
+// serve runs the REST API: stations serve [-addr host:port]
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "listening on %s\n", *addr)
+	return server.New().ListenAndServe(*addr)
+}
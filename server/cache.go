@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"gitea.kood.tech/innocentkwizera1/stations/graph"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// cachedNetwork is a parsed network with the graphs built for it
+type cachedNetwork struct {
+	network    *types.Network
+	compact    *graph.Compact
+	pathfinder *graph.AdvancedPathfinder
+}
+
+func newCachedNetwork(network *types.Network) *cachedNetwork {
+	compact := graph.NewCompact(network)
+	return &cachedNetwork{
+		network:    network,
+		compact:    compact,
+		pathfinder: graph.NewAdvancedPathfinderFromCompact(network, compact),
+	}
+}
+
+// networkCache keeps parsed networks and their pathfinders keyed by the
+// hash of their source so repeated queries against the same map skip
+// parsing and building graphs. The oldest entry is evicted once capacity is
+// reached. Cached entries are shared read-only.
+type networkCache struct {
+	mu       sync.Mutex
+	entries  map[string]*cachedNetwork
+	order    []string
+	capacity int
+}
+
+func newNetworkCache(capacity int) *networkCache {
+	return &networkCache{
+		entries:  make(map[string]*cachedNetwork),
+		capacity: capacity,
+	}
+}
+
+// contentKey hashes a map source together with its format
+func contentKey(format string, source []byte) string {
+	sum := sha256.Sum256(append([]byte(format+"\x00"), source...))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *networkCache) get(key string) (*cachedNetwork, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *networkCache) put(key string, entry *cachedNetwork) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; exists {
+		return
+	}
+	if len(c.order) >= c.capacity {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[key] = entry
+	c.order = append(c.order, key)
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+	"gitea.kood.tech/innocentkwizera1/stations/simulation"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+	"gitea.kood.tech/innocentkwizera1/stations/validation"
+)
+
+const (
+	maxRequestBytes = 16 << 20
+	cacheCapacity   = 64
+
+	// Bounds on the work one request may ask for, so a single client
+	// cannot tie up the server
+	maxTrains      = 1000
+	maxCycles      = 100
+	maxStations    = 2000
+	maxConnections = 8000
+
+	// simulateTimeout bounds the time spent on one simulate request,
+	// whether or not its client is still waiting
+	simulateTimeout = time.Minute
+)
+
+// Server exposes the simulator over a local REST API
+type Server struct {
+	cache   *networkCache
+	streams *streams
+	mux     *http.ServeMux
+
+	// How long a simulate request and an event feed may run
+	timeout       time.Duration
+	streamTimeout time.Duration
+}
+
+func New() *Server {
+	s := &Server{
+		cache:         newNetworkCache(cacheCapacity),
+		streams:       newStreams(),
+		mux:           http.NewServeMux(),
+		timeout:       simulateTimeout,
+		streamTimeout: streamTimeout,
+	}
+	s.mux.HandleFunc("POST /simulate", s.handleSimulate)
+	s.mux.HandleFunc("POST /streams", s.handleStreamCreate)
+	s.mux.HandleFunc("GET /streams/{id}/events", s.handleStreamEvents)
+	s.mux.HandleFunc("POST /streams/{id}/pause", s.handleStreamControl(func(st *stream) { st.setPaused(true) }))
+	s.mux.HandleFunc("POST /streams/{id}/resume", s.handleStreamControl(func(st *stream) { st.setPaused(false) }))
+	s.mux.HandleFunc("POST /streams/{id}/step", s.handleStreamControl((*stream).step))
+	return s
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// ListenAndServe serves the API on addr until the listener fails
+func (s *Server) ListenAndServe(addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// simulateRequest carries the map either as the text format in a JSON
+// string or as a parser.JSONMap object
+type simulateRequest struct {
+	Map    json.RawMessage `json:"map"`
+	Start  string          `json:"start"`
+	End    string          `json:"end"`
+	Trains int             `json:"trains"`
+	// Scenario is an optional scenario in the text format
+	Scenario string `json:"scenario,omitempty"`
+	// Service is oneway (the default), shuttle or loop, and Cycles the
+	// number of round trips of a shuttle or loop
+	Service string `json:"service,omitempty"`
+	Cycles  int    `json:"cycles,omitempty"`
+}
+
+// scenario parses the request's scenario, if any
+func (req simulateRequest) scenario() (*types.Scenario, error) {
+	if req.Scenario == "" {
+		return nil, nil
+	}
+	return parser.ParseScenario(strings.NewReader(req.Scenario))
+}
+
+// service returns the request's service, one way if none is given
+func (req simulateRequest) service() (simulation.Service, error) {
+	if req.Service == "" {
+		return simulation.OneWay, nil
+	}
+	service, ok := simulation.ParseService(req.Service)
+	if !ok {
+		return service, fmt.Errorf("unknown service %q", req.Service)
+	}
+	return service, nil
+}
+
+// checkLimits rejects a request asking for more trains, cycles or a larger
+// map than the server runs
+func (req simulateRequest) checkLimits(network *types.Network) error {
+	switch {
+	case req.Trains > maxTrains:
+		return fmt.Errorf("at most %d trains per request, got %d", maxTrains, req.Trains)
+	case req.Cycles > maxCycles:
+		return fmt.Errorf("at most %d cycles per request, got %d", maxCycles, req.Cycles)
+	case len(network.Stations) > maxStations:
+		return fmt.Errorf("map has %d stations, at most %d allowed", len(network.Stations), maxStations)
+	case countConnections(network) > maxConnections:
+		return fmt.Errorf("map has %d connections, at most %d allowed", countConnections(network), maxConnections)
+	}
+	return nil
+}
+
+type simulateResponse struct {
+	Schedule        []string                    `json:"schedule,omitempty"`
+	Stats           *stats                      `json:"stats,omitempty"`
+	MissedDeadlines []simulation.MissedDeadline `json:"missed_deadlines,omitempty"`
+	Delays          *simulation.DelayReport     `json:"delays,omitempty"`
+	Errors          []string                    `json:"errors,omitempty"`
+}
+
+type stats struct {
+	Turns       int     `json:"turns"`
+	Trains      int     `json:"trains"`
+	Stations    int     `json:"stations"`
+	Connections int     `json:"connections"`
+	Cached      bool    `json:"cached"`
+	DurationMS  float64 `json:"duration_ms"`
+}
+
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	var req simulateRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err := decoder.Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	loaded, cached, err := s.loadNetwork(req.Map)
+	if err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	network := loaded.network
+	if err := req.checkLimits(network); err != nil {
+		writeErrors(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateWithCompact(network, loaded.compact, req.Start, req.End, req.Trains); err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	scenario, err := req.scenario()
+	if err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	service, err := req.service()
+	if err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	began := time.Now()
+	simulator := simulation.NewSimulatorWithPathfinder(network, loaded.pathfinder, req.Start, req.End, req.Trains)
+	if err := simulator.SetScenario(scenario); err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	simulator.SetService(service, req.Cycles)
+	schedule, err := simulator.RunContext(ctx)
+	resp := simulateResponse{
+		Schedule:        schedule,
+		MissedDeadlines: simulator.MissedDeadlines(),
+		Stats: &stats{
+			Turns:       simulator.Turn(),
+			Trains:      req.Trains,
+			Stations:    len(network.Stations),
+			Connections: countConnections(network),
+			Cached:      cached,
+			DurationMS:  float64(time.Since(began).Microseconds()) / 1000,
+		},
+	}
+	if err == nil && scenario != nil && len(scenario.Closures) > 0 {
+		resp.Delays, err = simulator.CompareToBaseline(ctx)
+	}
+
+	// The client went away and reads no response
+	if r.Context().Err() != nil {
+		return
+	}
+
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusServiceUnavailable
+		resp.Errors = []string{fmt.Sprintf("gave up after %v: %v", s.timeout, err)}
+	case err != nil:
+		status = http.StatusUnprocessableEntity
+		resp.Errors = []string{err.Error()}
+	}
+	writeJSON(w, status, resp)
+}
+
+// loadNetwork parses the map from the request and builds its pathfinder,
+// reusing a cached entry when the same content was seen before
+func (s *Server) loadNetwork(raw json.RawMessage) (*cachedNetwork, bool, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, false, fmt.Errorf("missing map")
+	}
+
+	var format string
+	var parse func() (*types.Network, error)
+	switch raw[0] {
+	case '"':
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, false, err
+		}
+		format, raw = "text", []byte(text)
+		parse = func() (*types.Network, error) {
+			return parser.Parse(bytes.NewReader(raw))
+		}
+	case '{':
+		format = "json"
+		parse = func() (*types.Network, error) {
+			return parser.ParseJSON(raw)
+		}
+	default:
+		return nil, false, fmt.Errorf("map must be a string or an object")
+	}
+
+	key := contentKey(format, raw)
+	if entry, ok := s.cache.get(key); ok {
+		return entry, true, nil
+	}
+
+	network, err := parse()
+	if err != nil {
+		return nil, false, err
+	}
+	entry := newCachedNetwork(network)
+	s.cache.put(key, entry)
+	return entry, false, nil
+}
+
+func countConnections(network *types.Network) int {
+	total := 0
+	for _, neighbors := range network.Connections {
+		total += len(neighbors)
+	}
+	return total / 2
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...error) {
+	resp := simulateResponse{}
+	for _, err := range errs {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+	writeJSON(w, status, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadMap reads a map from test_maps as the JSON string a request carries
+func loadMap(t *testing.T, name string) json.RawMessage {
+	t.Helper()
+	text, err := os.ReadFile("../test_maps/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(string(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// post sends v as JSON to path and decodes the response into out
+func post(t *testing.T, handler http.Handler, path string, v, out any) int {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	if out != nil {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("%s: decoding response: %v", path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestSimulateCache(t *testing.T) {
+	handler := New().Handler()
+	jungle := loadMap(t, "jungle_desert.map")
+	jsonMap := json.RawMessage(`{
+		"stations": [{"name": "a", "x": 0, "y": 0}, {"name": "b", "x": 1, "y": 0}, {"name": "c", "x": 2, "y": 0}],
+		"connections": [{"from": "a", "to": "b"}, {"from": "b", "to": "c"}]
+	}`)
+
+	tests := []struct {
+		name       string
+		req        simulateRequest
+		wantCached bool
+	}{
+		{"first request parses", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 4}, false},
+		{"same map is cached", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 10}, true},
+		{"other stations share the entry", simulateRequest{Map: jungle, Start: "desert", End: "jungle", Trains: 2}, true},
+		{"json map parses", simulateRequest{Map: jsonMap, Start: "a", End: "c", Trains: 2}, false},
+		{"json map is cached", simulateRequest{Map: jsonMap, Start: "c", End: "a", Trains: 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp simulateResponse
+			if code := post(t, handler, "/simulate", tt.req, &resp); code != http.StatusOK {
+				t.Fatalf("status %d: %v", code, resp.Errors)
+			}
+			if resp.Stats.Cached != tt.wantCached {
+				t.Errorf("cached %v, want %v", resp.Stats.Cached, tt.wantCached)
+			}
+			if len(resp.Schedule) != resp.Stats.Turns {
+				t.Errorf("%d schedule lines in %d turns", len(resp.Schedule), resp.Stats.Turns)
+			}
+		})
+	}
+
+	// A cached network gives the same schedule as a fresh parse
+	req := simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 10}
+	var cached, fresh simulateResponse
+	post(t, handler, "/simulate", req, &cached)
+	post(t, New().Handler(), "/simulate", req, &fresh)
+	if !cached.Stats.Cached || fresh.Stats.Cached {
+		t.Fatalf("cached %v and %v, want true and false", cached.Stats.Cached, fresh.Stats.Cached)
+	}
+	if strings.Join(cached.Schedule, "\n") != strings.Join(fresh.Schedule, "\n") {
+		t.Errorf("cached schedule\n%s\ndiffers from\n%s", strings.Join(cached.Schedule, "\n"), strings.Join(fresh.Schedule, "\n"))
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	jungle := loadMap(t, "jungle_desert.map")
+
+	tests := []struct {
+		name     string
+		req      simulateRequest
+		timeout  time.Duration
+		wantCode int
+		wantErr  string
+	}{
+		{"no map", simulateRequest{Start: "a", End: "b", Trains: 1}, 0, http.StatusUnprocessableEntity, "map must be"},
+		{"too many trains", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: maxTrains + 1}, 0, http.StatusBadRequest, "at most"},
+		{"unknown station", simulateRequest{Map: jungle, Start: "jungle", End: "nowhere", Trains: 1}, 0, http.StatusUnprocessableEntity, "does not exist"},
+		{"unknown service", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 1, Service: "ferry"}, 0, http.StatusUnprocessableEntity, "ferry"},
+		{"timeout", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 10}, time.Nanosecond, http.StatusServiceUnavailable, "gave up"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			if tt.timeout > 0 {
+				s.timeout = tt.timeout
+			}
+			var resp simulateResponse
+			code := post(t, s.Handler(), "/simulate", tt.req, &resp)
+			if code != tt.wantCode {
+				t.Errorf("status %d, want %d", code, tt.wantCode)
+			}
+			if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0], tt.wantErr) {
+				t.Errorf("errors %q, want one containing %q", resp.Errors, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadNetworkSharesPathfinder(t *testing.T) {
+	s := New()
+	jungle := loadMap(t, "jungle_desert.map")
+	first, _, err := s.loadNetwork(jungle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, cached, err := s.loadNetwork(jungle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached || again.pathfinder != first.pathfinder || again.compact != first.compact {
+		t.Errorf("second load cached %v, pathfinder shared %v", cached, again.pathfinder == first.pathfinder)
+	}
+}
+
+func TestSimulateClientGone(t *testing.T) {
+	body, err := json.Marshal(simulateRequest{Map: loadMap(t, "jungle_desert.map"), Start: "jungle", End: "desert", Trains: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	New().Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/simulate", bytes.NewReader(body)).WithContext(ctx))
+	if rec.Body.Len() != 0 {
+		t.Errorf("answered a client that went away with status %d: %s", rec.Code, rec.Body)
+	}
+}
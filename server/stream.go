@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitea.kood.tech/innocentkwizera1/stations/simulation"
+	"gitea.kood.tech/innocentkwizera1/stations/validation"
+)
+
+const (
+	// streamIdleTimeout is how long a created stream may wait for a client
+	// to open its event feed before it is discarded
+	streamIdleTimeout = 5 * time.Minute
+
+	// maxStreams bounds the streams open at once, whether waiting for a
+	// client or running
+	maxStreams = 100
+
+	// streamTimeout bounds how long an event feed stays open, paused or not
+	streamTimeout = 30 * time.Minute
+)
+
+// streamRequest is a simulateRequest that may start paused
+type streamRequest struct {
+	simulateRequest
+	Paused bool `json:"paused"`
+}
+
+type streamCreated struct {
+	ID     string `json:"id"`
+	Events string `json:"events"`
+}
+
+// turnEvent is sent for every simulated turn
+type turnEvent struct {
+	Turn  int                    `json:"turn"`
+	Moves []simulation.TrainMove `json:"moves"`
+}
+
+type doneEvent struct {
+	Turns int    `json:"turns"`
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	errStreamAttached = errors.New("stream already has a client")
+	errStreamExpired  = errors.New("stream expired before a client attached")
+)
+
+// stream is a simulation waiting to be played to a client. The simulator
+// only advances while the stream is running or has steps to spend, so a
+// paused client holds the run at the current turn.
+type stream struct {
+	simulator *simulation.AdvancedSimulator
+	// idle discards the stream unless a client attaches first
+	idle *time.Timer
+
+	mu       sync.Mutex
+	paused   bool
+	steps    int
+	attached bool
+	wake     chan struct{}
+}
+
+// streams tracks the streams created but not yet finished
+type streams struct {
+	mu      sync.Mutex
+	entries map[string]*stream
+
+	// How many streams may be open at once, and how long one may wait for
+	// its client
+	capacity    int
+	idleTimeout time.Duration
+}
+
+func newStreams() *streams {
+	return &streams{
+		entries:     make(map[string]*stream),
+		capacity:    maxStreams,
+		idleTimeout: streamIdleTimeout,
+	}
+}
+
+// add registers a stream and starts its idle timer, or reports false if
+// the server has as many streams open as it takes
+func (ss *streams) add(st *stream) (string, bool) {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.entries) >= ss.capacity {
+		return "", false
+	}
+	ss.entries[id] = st
+	st.idle = time.AfterFunc(ss.idleTimeout, func() { ss.remove(id) })
+	return id, true
+}
+
+func (ss *streams) get(id string) (*stream, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	st, ok := ss.entries[id]
+	return st, ok
+}
+
+func (ss *streams) remove(id string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.entries, id)
+}
+
+// attach claims the stream for one event feed, stopping its idle timer. It
+// fails if the stream has a client already or the timer went off first.
+func (st *stream) attach() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.attached {
+		return errStreamAttached
+	}
+	if !st.idle.Stop() {
+		return errStreamExpired
+	}
+	st.attached = true
+	return nil
+}
+
+func (st *stream) setPaused(paused bool) {
+	st.mu.Lock()
+	st.paused = paused
+	st.mu.Unlock()
+	st.signal()
+}
+
+// step lets one more turn through while paused
+func (st *stream) step() {
+	st.mu.Lock()
+	st.steps++
+	st.mu.Unlock()
+	st.signal()
+}
+
+func (st *stream) signal() {
+	select {
+	case st.wake <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until the next turn may be simulated or ctx is done
+func (st *stream) wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		st.mu.Lock()
+		if !st.paused {
+			st.mu.Unlock()
+			return nil
+		}
+		if st.steps > 0 {
+			st.steps--
+			st.mu.Unlock()
+			return nil
+		}
+		st.mu.Unlock()
+
+		select {
+		case <-st.wake:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (s *Server) handleStreamCreate(w http.ResponseWriter, r *http.Request) {
+	var req streamRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err := decoder.Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	loaded, _, err := s.loadNetwork(req.Map)
+	if err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	network := loaded.network
+	if err := req.checkLimits(network); err != nil {
+		writeErrors(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateWithCompact(network, loaded.compact, req.Start, req.End, req.Trains); err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	scenario, err := req.scenario()
+	if err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	service, err := req.service()
+	if err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	simulator := simulation.NewSimulatorWithPathfinder(network, loaded.pathfinder, req.Start, req.End, req.Trains)
+	if err := simulator.SetScenario(scenario); err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	simulator.SetService(service, req.Cycles)
+
+	id, ok := s.streams.add(&stream{
+		simulator: simulator,
+		paused:    req.Paused,
+		wake:      make(chan struct{}, 1),
+	})
+	if !ok {
+		writeErrors(w, http.StatusServiceUnavailable, fmt.Errorf("at most %d streams at once", s.streams.capacity))
+		return
+	}
+	writeJSON(w, http.StatusCreated, streamCreated{
+		ID:     id,
+		Events: "/streams/" + id + "/events",
+	})
+}
+
+// handleStreamEvents runs the simulation and sends every turn as a
+// Server-Sent Event. A "done" event closes the feed. Each turn is simulated
+// only once the stream lets it through, so a paused client sees the turn
+// the simulator is at.
+func (s *Server) handleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	st, ok := s.streams.get(id)
+	if !ok {
+		writeErrors(w, http.StatusNotFound, fmt.Errorf("unknown stream %q", id))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrors(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+	if err := st.attach(); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errStreamExpired) {
+			status = http.StatusNotFound
+		}
+		writeErrors(w, status, fmt.Errorf("%w: %q", err, id))
+		return
+	}
+	defer s.streams.remove(id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.streamTimeout)
+	defer cancel()
+
+	simulator := st.simulator
+	err := simulator.Prepare(ctx)
+	for err == nil && !simulator.Done() {
+		if err = st.wait(ctx); err != nil {
+			break
+		}
+		var moves []simulation.TrainMove
+		moves, err = simulator.Step()
+		// A failed turn may still have moved some trains
+		if err == nil || len(moves) > 0 {
+			if writeEvent(w, "turn", turnEvent{Turn: simulator.Turn(), Moves: moves}) != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+	// The client went away
+	if r.Context().Err() != nil {
+		return
+	}
+
+	done := doneEvent{Turns: simulator.Turn()}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		done.Error = fmt.Sprintf("gave up after %v: %v", s.streamTimeout, err)
+	case err != nil:
+		done.Error = err.Error()
+	}
+	writeEvent(w, "done", done)
+	flusher.Flush()
+}
+
+func (s *Server) handleStreamControl(action func(*stream)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		st, ok := s.streams.get(id)
+		if !ok {
+			writeErrors(w, http.StatusNotFound, fmt.Errorf("unknown stream %q", id))
+			return
+		}
+		action(st)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type event struct {
+	name string
+	data string
+}
+
+// parseEvents splits an event stream into its events
+func parseEvents(t *testing.T, r io.Reader) []event {
+	t.Helper()
+	var events []event
+	var current event
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.name != "" {
+				events = append(events, current)
+			}
+			current = event{}
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// feed is a ResponseWriter for event streams that hands over what was
+// written each time it is flushed
+type feed struct {
+	header http.Header
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	chunks chan string
+}
+
+func newFeed() *feed {
+	return &feed{header: http.Header{}, chunks: make(chan string, 16)}
+}
+
+func (f *feed) Header() http.Header { return f.header }
+func (f *feed) WriteHeader(int)     {}
+
+func (f *feed) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buf.Write(p)
+}
+
+func (f *feed) Flush() {
+	f.mu.Lock()
+	chunk := f.buf.String()
+	f.buf.Reset()
+	f.mu.Unlock()
+	f.chunks <- chunk
+}
+
+// next returns the events of the next flush
+func (f *feed) next(t *testing.T) []event {
+	t.Helper()
+	select {
+	case chunk := <-f.chunks:
+		return parseEvents(t, strings.NewReader(chunk))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no events within 5s")
+		return nil
+	}
+}
+
+// createStream starts a stream and returns its id
+func createStream(t *testing.T, s *Server, req streamRequest) string {
+	t.Helper()
+	var created streamCreated
+	if code := post(t, s.Handler(), "/streams", req, &created); code != http.StatusCreated {
+		t.Fatalf("creating stream: status %d", code)
+	}
+	return created.ID
+}
+
+func TestStreamEvents(t *testing.T) {
+	jungle := loadMap(t, "jungle_desert.map")
+
+	tests := []struct {
+		name string
+		req  simulateRequest
+	}{
+		{"one way", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 10}},
+		{"shuttle", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 4, Service: "shuttle", Cycles: 2}},
+		{"closure", simulateRequest{Map: jungle, Start: "jungle", End: "desert", Trains: 6,
+			Scenario: "disruptions:\nclose station farms from turn 1 to 4\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			srv := httptest.NewServer(s.Handler())
+			defer srv.Close()
+
+			var want simulateResponse
+			if code := post(t, s.Handler(), "/simulate", tt.req, &want); code != http.StatusOK {
+				t.Fatalf("simulate: status %d: %v", code, want.Errors)
+			}
+
+			id := createStream(t, s, streamRequest{simulateRequest: tt.req})
+			resp, err := http.Get(srv.URL + "/streams/" + id + "/events")
+			if err != nil {
+				t.Fatal(err)
+			}
+			events := parseEvents(t, resp.Body)
+			resp.Body.Close()
+
+			// One turn event per turn in order, then done
+			if len(events) == 0 || events[len(events)-1].name != "done" {
+				t.Fatalf("events %v, want them to end with done", events)
+			}
+			var schedule []string
+			for i, e := range events[:len(events)-1] {
+				var turn turnEvent
+				if e.name != "turn" || json.Unmarshal([]byte(e.data), &turn) != nil || turn.Turn != i+1 {
+					t.Fatalf("event %d is %s %s, want turn %d", i, e.name, e.data, i+1)
+				}
+				if len(turn.Moves) > 0 {
+					schedule = append(schedule, formatTurn(turn))
+				}
+			}
+			var done doneEvent
+			if err := json.Unmarshal([]byte(events[len(events)-1].data), &done); err != nil {
+				t.Fatal(err)
+			}
+			if done.Error != "" || done.Turns != len(events)-1 || done.Turns != want.Stats.Turns {
+				t.Errorf("done %+v after %d turn events, want %d turns and no error", done, len(events)-1, want.Stats.Turns)
+			}
+			if strings.Join(schedule, "\n") != strings.Join(want.Schedule, "\n") {
+				t.Errorf("streamed\n%s\nwant\n%s", strings.Join(schedule, "\n"), strings.Join(want.Schedule, "\n"))
+			}
+
+			// A finished stream is gone
+			resp, err = http.Get(srv.URL + "/streams/" + id + "/events")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("reopened finished stream: status %d, want %d", resp.StatusCode, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+// formatTurn writes a turn's moves the way the schedule does
+func formatTurn(turn turnEvent) string {
+	moves := make([]string, len(turn.Moves))
+	for i, move := range turn.Moves {
+		moves[i] = move.String()
+	}
+	return strings.Join(moves, " ")
+}
+
+func TestStreamPausedDisconnect(t *testing.T) {
+	s := New()
+	id := createStream(t, s, streamRequest{
+		simulateRequest: simulateRequest{Map: loadMap(t, "jungle_desert.map"), Start: "jungle", End: "desert", Trains: 10},
+		Paused:          true,
+	})
+	st, _ := s.streams.get(id)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	f := newFeed()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		req := httptest.NewRequest(http.MethodGet, "/streams/"+id+"/events", nil)
+		s.Handler().ServeHTTP(f, req.WithContext(ctx))
+	}()
+	if events := f.next(t); len(events) != 0 {
+		t.Fatalf("paused stream sent %v before any step", events)
+	}
+
+	// The feed has its client
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/streams/"+id+"/events", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second client: status %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	if code := post(t, s.Handler(), "/streams/"+id+"/step", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("step: status %d", code)
+	}
+	events := f.next(t)
+	var turn turnEvent
+	if len(events) != 1 || events[0].name != "turn" || json.Unmarshal([]byte(events[0].data), &turn) != nil || turn.Turn != 1 {
+		t.Fatalf("step sent %v, want turn 1", events)
+	}
+
+	disconnect()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("feed still open 5s after the client left")
+	}
+
+	// The simulator stopped at the turn sent, and nothing more was written
+	if got := st.simulator.Turn(); got != 1 {
+		t.Errorf("simulator at turn %d after the client saw turn 1", got)
+	}
+	if len(f.chunks) != 0 {
+		t.Errorf("%d more flushes after the client left", len(f.chunks))
+	}
+	if _, ok := s.streams.get(id); ok {
+		t.Error("stream kept after its client left")
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	s := New()
+	s.streamTimeout = 50 * time.Millisecond
+	id := createStream(t, s, streamRequest{
+		simulateRequest: simulateRequest{Map: loadMap(t, "jungle_desert.map"), Start: "jungle", End: "desert", Trains: 4},
+		Paused:          true,
+	})
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/streams/"+id+"/events", nil))
+	events := parseEvents(t, rec.Body)
+
+	var done doneEvent
+	if len(events) != 1 || events[0].name != "done" || json.Unmarshal([]byte(events[0].data), &done) != nil {
+		t.Fatalf("events %v, want a single done", events)
+	}
+	if done.Turns != 0 || !strings.Contains(done.Error, "gave up") {
+		t.Errorf("done %+v, want no turns and a timeout error", done)
+	}
+}
+
+func TestStreamIdleReaped(t *testing.T) {
+	s := New()
+	s.streams.idleTimeout = 20 * time.Millisecond
+	id := createStream(t, s, streamRequest{
+		simulateRequest: simulateRequest{Map: loadMap(t, "jungle_desert.map"), Start: "jungle", End: "desert", Trains: 4},
+	})
+
+	// No other stream is created to trigger the eviction
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := s.streams.get(id); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("idle stream still there after 5s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/streams/"+id+"/events", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("reaped stream: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestStreamAttachedNotReaped(t *testing.T) {
+	s := New()
+	s.streams.idleTimeout = 20 * time.Millisecond
+	id := createStream(t, s, streamRequest{
+		simulateRequest: simulateRequest{Map: loadMap(t, "jungle_desert.map"), Start: "jungle", End: "desert", Trains: 4},
+		Paused:          true,
+	})
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	defer disconnect()
+	f := newFeed()
+	go s.Handler().ServeHTTP(f, httptest.NewRequest(http.MethodGet, "/streams/"+id+"/events", nil).WithContext(ctx))
+	f.next(t)
+
+	time.Sleep(50 * time.Millisecond)
+	if code := post(t, s.Handler(), "/streams/"+id+"/step", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("step on an attached stream past its idle timeout: status %d", code)
+	}
+	if events := f.next(t); len(events) != 1 || events[0].name != "turn" {
+		t.Errorf("step sent %v, want a turn", events)
+	}
+}
+
+func TestStreamLimit(t *testing.T) {
+	s := New()
+	s.streams.capacity = 2
+	req := streamRequest{
+		simulateRequest: simulateRequest{Map: loadMap(t, "jungle_desert.map"), Start: "jungle", End: "desert", Trains: 4},
+	}
+	first := createStream(t, s, req)
+	createStream(t, s, req)
+
+	var resp simulateResponse
+	if code := post(t, s.Handler(), "/streams", req, &resp); code != http.StatusServiceUnavailable {
+		t.Fatalf("stream past the limit: status %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0], "at most 2 streams") {
+		t.Errorf("errors %q, want the limit", resp.Errors)
+	}
+
+	// A finished stream makes room
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/streams/"+first+"/events", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("running stream: status %d", rec.Code)
+	}
+	createStream(t, s, req)
+}
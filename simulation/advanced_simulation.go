@@ -1,22 +1,50 @@
 package simulation
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
 	"gitea.kood.tech/innocentkwizera1/stations/graph"
 	"gitea.kood.tech/innocentkwizera1/stations/types"
 )
 
 type AdvancedSimulator struct {
-	network     *types.Network
-	start       string
-	end         string
-	numTrains   int
-	trains      []*types.Train
-	pathfinder  *graph.AdvancedPathfinder
-	scheduler   *TrainScheduler
+	network          *types.Network
+	start            string
+	end              string
+	numTrains        int
+	trains           []*types.Train
+	byName           map[string]*types.Train
+	pathfinder       *graph.AdvancedPathfinder
+	scheduler        *TrainScheduler
+	observers        []Observer
+	reroute          bool
+	rerouteSlack     int
+	planned          map[string]int
+	waiting          map[string]Block
+	waitingAny       map[string][]string
+	resolveDeadlocks bool
+	turnLimit        int
+	scenario         *types.Scenario
+	arrivedAt        map[string]int
+	agingTurns       int
+	topPriority      int
+	signals          *signalling
+	closed           *closedSet
+	routes           [][]string
+	service          Service
+	cycles           int
+	sharedRoutes     bool
+	metered          bool
+	loopSlots        int
+	outside          map[string]bool
+	prepared         bool
+	prepareErr       error
+	turn             int
+	maxTurns         int
 }
 
 type TrainScheduler struct {
@@ -26,14 +54,22 @@ type TrainScheduler struct {
 }
 
 func NewAdvancedSimulator(network *types.Network, start, end string, numTrains int) *AdvancedSimulator {
+	return newAdvancedSimulator(network, graph.NewAdvancedPathfinder(network), start, end, numTrains)
+}
+
+// newAdvancedSimulator is NewAdvancedSimulator with a pathfinder already
+// built for network
+func newAdvancedSimulator(network *types.Network, pathfinder *graph.AdvancedPathfinder, start, end string, numTrains int) *AdvancedSimulator {
 	return &AdvancedSimulator{
 		network:     network,
 		start:       start,
 		end:         end,
 		numTrains:   numTrains,
 		trains:      make([]*types.Train, 0),
-		pathfinder:  graph.NewAdvancedPathfinder(network),
+		pathfinder:  pathfinder,
 		scheduler:   NewTrainScheduler(),
+		arrivedAt:   make(map[string]int),
+		agingTurns:  DefaultAgingTurns,
 	}
 }
 
@@ -45,21 +81,193 @@ func NewTrainScheduler() *TrainScheduler {
 	}
 }
 
+// record stores the tracks used during the current time step and the
+// stations occupied at its end
+func (ts *TrainScheduler) record(claims *turnClaims) {
+	mark(ts.trackUsed, claims.tracks, ts.timeStep)
+	mark(ts.stationOccupied, claims.stations, ts.timeStep)
+}
+
+// tracksAt returns the tracks used during time step t in name order
+func (ts *TrainScheduler) tracksAt(t int) []string {
+	return markedAt(ts.trackUsed, t)
+}
+
+// stationsAt returns the stations occupied at the end of time step t
+func (ts *TrainScheduler) stationsAt(t int) []string {
+	return markedAt(ts.stationOccupied, t)
+}
+
+func mark(table map[string]map[int]bool, keys map[string]string, t int) {
+	for key := range keys {
+		if table[key] == nil {
+			table[key] = make(map[int]bool)
+		}
+		table[key][t] = true
+	}
+}
+
+func markedAt(table map[string]map[int]bool, t int) []string {
+	keys := []string{}
+	for key, times := range table {
+		if times[t] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Run simulates every turn and returns those in which trains moved, one
+// line each, in the output format
 func (as *AdvancedSimulator) Run() ([]string, error) {
+	return as.RunContext(context.Background())
+}
+
+// RunContext is Run, stopping with a CanceledError once ctx is done, both
+// while routes are planned and between turns
+func (as *AdvancedSimulator) RunContext(ctx context.Context) ([]string, error) {
+	moves := []string{}
+	err := as.RunFuncContext(ctx, func(turn int, trainMoves []TrainMove) error {
+		if len(trainMoves) > 0 {
+			moves = append(moves, formatMoves(trainMoves))
+		}
+		return nil
+	})
+	return moves, err
+}
+
+// RunFunc runs the simulation and calls fn with each turn's moves as soon as
+// the turn is executed. If fn returns an error the run stops with it.
+func (as *AdvancedSimulator) RunFunc(fn func(turn int, moves []TrainMove) error) error {
+	return as.RunFuncContext(context.Background(), fn)
+}
+
+// RunFuncContext is RunFunc, stopping with a CanceledError once ctx is done
+func (as *AdvancedSimulator) RunFuncContext(ctx context.Context, fn func(turn int, moves []TrainMove) error) error {
+	if err := as.prepareContext(ctx); err != nil {
+		return err
+	}
+	
+	// Run advanced simulation with conflict resolution
+	return as.simulateWithScheduling(ctx, fn)
+}
+
+// SetMaxTurns overrides the turn limit derived from the planned routes. A
+// limit of zero or less restores the derived one.
+func (as *AdvancedSimulator) SetMaxTurns(limit int) {
+	as.turnLimit = limit
+	if as.prepared {
+		as.maxTurns = as.calculateMaxTurns()
+	}
+}
+
+// MaxTurns returns the number of turns the simulation may take, or why it
+// cannot start
+func (as *AdvancedSimulator) MaxTurns() (int, error) {
+	if err := as.prepare(); err != nil {
+		return 0, err
+	}
+	return as.maxTurns, nil
+}
+
+// Prepare places the trains and plans their routes, which Step otherwise
+// does on its first call, stopping with a CanceledError once ctx is done
+func (as *AdvancedSimulator) Prepare(ctx context.Context) error {
+	return as.prepareContext(ctx)
+}
+
+// Step advances the simulation by exactly one turn and returns the moves
+// made in it. Once every train has arrived it returns no moves. It fails when
+// the turn limit is reached first, or when the simulation cannot start.
+func (as *AdvancedSimulator) Step() ([]TrainMove, error) {
+	if err := as.prepare(); err != nil {
+		return nil, err
+	}
+	if as.allTrainsAtDestination() {
+		return nil, nil
+	}
+	if as.turn >= as.maxTurns {
+		return nil, fmt.Errorf("%w (%d)", errors.ErrTurnLimit, as.maxTurns)
+	}
+	
+	as.turn++
+	as.scheduler.timeStep = as.turn
+	if err := as.checkClosedOff(); err != nil {
+		return nil, err
+	}
+	moves := as.executeTurn()
+	
+	if deadlock := as.findDeadlock(); deadlock != nil {
+		if !as.resolveDeadlocks || !as.resolveDeadlock(deadlock) {
+			return moves, deadlock
+		}
+	}
+	
+	return moves, nil
+}
+
+// Done reports whether every train has reached the end station. It is
+// false for a simulation that cannot start, whose Step returns why.
+func (as *AdvancedSimulator) Done() bool {
+	return as.prepare() == nil && as.allTrainsAtDestination()
+}
+
+// Turn returns the number of turns simulated so far
+func (as *AdvancedSimulator) Turn() int {
+	return as.turn
+}
+
+// prepare places the trains and plans their routes before the first turn
+func (as *AdvancedSimulator) prepare() error {
+	return as.prepareContext(context.Background())
+}
+
+// prepareContext is prepare, giving up when ctx is done. It can be retried
+// after ctx is done; other errors are kept and returned again.
+func (as *AdvancedSimulator) prepareContext(ctx context.Context) error {
+	if as.prepared || as.prepareErr != nil {
+		return as.prepareErr
+	}
+	
+	if err := as.checkDepots(); err != nil {
+		as.prepareErr = err
+		return err
+	}
+	
 	// Initialize trains
 	as.initializeTrains()
 	
-	// Find optimal paths using advanced pathfinding
-	paths := as.pathfinder.FindOptimalPaths(as.start, as.end, as.numTrains)
+	if as.routes == nil {
+		paths, err := as.choosePaths(ctx)
+		if err != nil {
+			return err
+		}
+		// Sort paths by length (shorter paths first)
+		sort.SliceStable(paths, func(i, j int) bool {
+			return len(paths[i]) < len(paths[j])
+		})
+		as.routes = paths
+	}
+	as.prepared = true
+	as.topPriority = topPriority(as.trains)
+	as.signals = as.newSignalling()
 	
 	// Assign paths to trains with load balancing
-	as.assignPathsToTrains(paths)
+	as.assignPathsToTrains(as.routes)
+	if err := as.checkLoop(); err != nil {
+		as.prepared = false
+		as.prepareErr = err
+		return err
+	}
 	
-	// Run advanced simulation with conflict resolution
-	return as.simulateWithScheduling()
+	as.maxTurns = as.calculateMaxTurns()
+	return nil
 }
 
 func (as *AdvancedSimulator) initializeTrains() {
+	as.trains = as.trains[:0]
+	as.byName = make(map[string]*types.Train, as.numTrains)
 	for i := 1; i <= as.numTrains; i++ {
 		train := &types.Train{
 			ID:       i,
@@ -68,71 +276,93 @@ func (as *AdvancedSimulator) initializeTrains() {
 			Path:     []string{},
 			PathPos:  0,
 		}
+		as.scenario.Apply(train)
 		as.trains = append(as.trains, train)
+		as.byName[train.Name] = train
 	}
 }
 
+// choosePaths picks the set of station-disjoint paths that gets all trains
+// to the end soonest. Trains on disjoint paths never block each other, so
+// only trains queueing on the same path interact.
+func (as *AdvancedSimulator) choosePaths(ctx context.Context) ([][]string, error) {
+	if as.service == Loop {
+		if route, err := as.loopRoute(ctx); route != nil || err != nil {
+			return route, err
+		}
+	}
+	
+	var best [][]string
+	bestTurns := 0
+	
+	for k := 1; k <= as.numTrains; k++ {
+		paths, err := as.pathfinder.FindDisjointPathsContext(ctx, as.start, as.end, k)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) < k {
+			break
+		}
+		
+		_, turns := as.planRoutes(paths)
+		if best == nil || turns < bestTurns {
+			best, bestTurns = paths, turns
+		}
+	}
+	
+	return best, nil
+}
+
 func (as *AdvancedSimulator) assignPathsToTrains(paths [][]string) {
 	if len(paths) == 0 {
 		return
 	}
 	
-	// Sort paths by length (shorter paths first)
-	sort.Slice(paths, func(i, j int) bool {
-		return len(paths[i]) < len(paths[j])
-	})
-	
 	// Assign paths to trains with load balancing
-	pathUsage := make([]int, len(paths))
+	assignment, _ := as.planRoutes(paths)
 	
+	as.planned = make(map[string]int, len(as.trains))
 	for i, train := range as.trains {
-		// Find the least used path
-		bestPathIdx := 0
-		for j, usage := range pathUsage {
-			if usage < pathUsage[bestPathIdx] {
-				bestPathIdx = j
-			}
-		}
-		
-		// If we have fewer paths than trains, distribute evenly
-		if i < len(paths) {
-			train.Path = make([]string, len(paths[i]))
-			copy(train.Path, paths[i])
-		} else {
-			pathIdx := i % len(paths)
-			train.Path = make([]string, len(paths[pathIdx]))
-			copy(train.Path, paths[pathIdx])
-		}
-		
-		pathUsage[bestPathIdx]++
+		train.Path = make([]string, len(paths[assignment[i]]))
+		copy(train.Path, paths[assignment[i]])
+		as.planned[train.Name] = len(train.Path) - 1
 	}
+	as.planLegs()
 }
 
-func (as *AdvancedSimulator) simulateWithScheduling() ([]string, error) {
-	moves := []string{}
-	turn := 0
-	maxTurns := as.calculateMaxTurns()
-	
-	for !as.allTrainsAtDestination() && turn < maxTurns {
-		turn++
-		as.scheduler.timeStep = turn
+func (as *AdvancedSimulator) simulateWithScheduling(ctx context.Context, fn func(turn int, moves []TrainMove) error) error {
+	for !as.Done() {
+		if err := errors.Canceled(ctx, fmt.Sprintf("simulation after turn %d", as.turn)); err != nil {
+			return err
+		}
 		
-		turnMoves := as.executeTurn()
+		turnMoves, stepErr := as.Step()
 		
-		if len(turnMoves) > 0 {
-			moves = append(moves, strings.Join(turnMoves, " "))
+		// A failed turn may still have moved some trains
+		if stepErr == nil || len(turnMoves) > 0 {
+			if err := fn(as.turn, turnMoves); err != nil {
+				return err
+			}
+		}
+		if stepErr != nil {
+			return stepErr
 		}
 	}
 	
-	if turn >= maxTurns {
-		return moves, fmt.Errorf("simulation exceeded maximum turns")
-	}
-	
-	return moves, nil
+	return nil
 }
 
-func (as *AdvancedSimulator) executeTurn() []string {
+func (as *AdvancedSimulator) executeTurn() []TrainMove {
 	var trainMoves []TrainMove
+	turn := as.scheduler.timeStep
+	as.waiting = make(map[string]Block)
+	as.waitingAny = make(map[string][]string)
+	as.notify(func(o Observer) { o.TurnStarted(turn) })
+	as.closed = as.activeClosures()
+	as.avoidClosures()
+	as.meter()
+	loads, outside := as.terminalLoads()
+	as.outside = outside
 	
 	// Create priority queue for train movements
 	candidates := as.generateMoveCandidates()
@@ -143,42 +373,167 @@ func (as *AdvancedSimulator) executeTurn() []string {
 	})
 	
 	// Execute moves in priority order
-	usedTracks := make(map[string]bool)
-	occupiedStations := as.getCurrentOccupiedStations()
+	claims := &turnClaims{
+		tracks:   make(map[string]string),
+		stations: as.getCurrentOccupiedStations(),
+		entered:  make(map[string]bool),
+		load:     loads,
+	}
+	as.holdTracks(claims)
 	
 	for _, candidate := range candidates {
-		if as.canExecuteMove(candidate, usedTracks, occupiedStations) {
-			as.executeMove(candidate)
+		if as.reroute {
+			candidate = as.rerouteIfBlocked(candidate, claims)
+		}
+		if as.crawl(candidate, claims) {
+			continue
+		}
+		if as.canExecuteMove(candidate, claims) {
+			candidate.train.Waited = 0
+			as.advance(candidate, claims)
+			as.passOn(candidate.train, claims)
+			candidate.train.ReadyAt = turn + as.dwellAt(candidate.train, candidate.train.Position) + 1
 			trainMoves = append(trainMoves, TrainMove{
 				TrainName: candidate.train.Name,
-				To:        candidate.nextStation,
+				To:        candidate.train.Position,
 			})
-			
-			// Update tracking
-			track := as.getTrackKey(candidate.train.Position, candidate.nextStation)
-			usedTracks[track] = true
-			
-			if candidate.nextStation != as.end {
-				occupiedStations[candidate.nextStation] = true
-			}
-			if candidate.train.Position != as.start {
-				delete(occupiedStations, candidate.train.Position)
+		} else {
+			if candidate.train.Progress > 0 {
+				// A slow train waiting at the end of its track still holds it
+				track := as.getTrackKey(candidate.train.Position, candidate.nextStation)
+				claims.tracks[track] = candidate.train.Name
 			}
 		}
 	}
 	
-	// Convert to string format
-	moveStrings := make([]string, len(trainMoves))
-	for i, move := range trainMoves {
-		moveStrings[i] = move.String()
+	as.scheduler.record(claims)
+	as.notify(func(o Observer) { o.TurnEnded(turn, trainMoves) })
+	
+	return trainMoves
+}
+
+// advance moves a train to the next station of its path and claims the
+// track and station it used
+func (as *AdvancedSimulator) advance(candidate MoveCandidate, claims *turnClaims) {
+	turn := as.scheduler.timeStep
+	from := candidate.train.Position
+	as.notify(func(o Observer) { o.TrainDeparted(turn, candidate.train.Name, from, candidate.nextStation) })
+	as.leaveTerminal(candidate.train, claims)
+	as.executeMove(candidate)
+	as.notify(func(o Observer) { o.TrainArrived(turn, candidate.train.Name, candidate.nextStation) })
+	train := candidate.train
+	if as.finished(train) {
+		as.arrivedAt[train.Name] = turn
+	}
+	
+	// Update tracking
+	track := as.getTrackKey(from, candidate.nextStation)
+	claims.tracks[track] = train.Name
+	as.recordSignals(train, track)
+	
+	// The start and end stations only take up room when a train turns back
+	// there, not when a rerouted train passes through
+	terminus := candidate.nextStation == as.start || candidate.nextStation == as.end
+	if as.terminalLimit(candidate.nextStation) > 0 {
+		claims.load[candidate.nextStation]++
+	} else if !as.finished(train) && (!terminus || train.PathPos == len(train.Path)-1) {
+		claims.stations[candidate.nextStation] = train.Name
+		claims.entered[candidate.nextStation] = true
 	}
 	
-	return moveStrings
+	// Free the station the rear of the train just left. The station a leg
+	// ends at takes a long train in whole.
+	cleared := train.Path[max(train.PathPos-train.Span(), 0):train.PathPos]
+	if train.PathPos < len(train.Path)-1 {
+		cleared = cleared[:min(len(cleared), 1)]
+	}
+	for _, station := range cleared {
+		if claims.stations[station] == train.Name {
+			delete(claims.stations, station)
+		}
+	}
+	as.turnBack(train)
+}
+
+// holdTracks claims the tracks under every train longer than one station
+// for the turn
+func (as *AdvancedSimulator) holdTracks(claims *turnClaims) {
+	for _, train := range as.trains {
+		if train.Span() == 1 || as.finished(train) {
+			continue
+		}
+		stations := train.Occupies()
+		for i := 1; i < len(stations); i++ {
+			claims.tracks[as.getTrackKey(stations[i-1], stations[i])] = train.Name
+		}
+	}
+}
+
+// passOn lets a fast train carry on past the station it just reached, up to
+// its speed, for as long as the way ahead is free. The stations passed are
+// left again in the same turn.
+func (as *AdvancedSimulator) passOn(train *types.Train, claims *turnClaims) {
+	for hop := 1; hop < train.TracksPerTurn() && train.PathPos > 0 && train.PathPos < len(train.Path)-1; hop++ {
+		next := MoveCandidate{train: train, nextStation: train.Path[train.PathPos+1]}
+		if _, blocked := as.blockReason(next, claims); blocked {
+			return
+		}
+		as.advance(next, claims)
+	}
+}
+
+// crawl moves a slow train one more turn along the track to its next
+// station, holding the track meanwhile. It reports false when the train is
+// due to arrive, leaving that move to the usual checks.
+func (as *AdvancedSimulator) crawl(candidate MoveCandidate, claims *turnClaims) bool {
+	train := candidate.train
+	if train.Progress+1 >= train.TurnsPerTrack() {
+		return false
+	}
+	
+	block := Block{Train: train.Name, From: train.Position, Next: candidate.nextStation, Reason: BlockedInTransit}
+	track := as.getTrackKey(train.Position, candidate.nextStation)
+	waits := true
+	if user := claims.tracks[track]; user != "" {
+		block.Reason, block.By = BlockedTrackUsed, user
+	} else if service, blocked := as.checkService(candidate, block); blocked {
+		block = service
+	} else if signal, blocked := as.checkSignals(candidate, claims, block); train.Progress == 0 && blocked {
+		block = signal
+	} else {
+		if train.Progress == 0 {
+			as.enterSignalBlock(train, track)
+			as.leaveTerminal(train, claims)
+		}
+		claims.tracks[track] = train.Name
+		train.Progress++
+		train.Waited = 0
+		waits = false
+	}
+	if waits && !as.queuedBehind(train, block) {
+		train.Waited++
+	}
+	if block.Reason == BlockedTrackUsed {
+		as.waiting[train.Name] = block
+	}
+	as.notify(func(o Observer) { o.TrainBlocked(as.scheduler.timeStep, block) })
+	return true
+}
+
+// turnClaims records which train holds each track and station while a turn
+// is executed
+type turnClaims struct {
+	tracks   map[string]string   // track -> train that used it this turn
+	stations map[string]string   // station -> train holding it
+	entered  map[string]bool     // stations a train moved into this turn
+	load     map[string]int      // trains at start and end stations of limited capacity
+	full     map[string][]string // trains at full terminals, found when first needed
 }
 
 type MoveCandidate struct {
 	train       *types.Train
 	nextStation string
+	level       int
 	priority    int
 }
 
@@ -186,18 +541,38 @@ func (as *AdvancedSimulator) generateMoveCandidates() []MoveCandidate {
 	var candidates []MoveCandidate
 	
 	for _, train := range as.trains {
-		if train.Position == as.end {
+		if as.finished(train) {
+			continue
+		}
+		if train.PathPos == 0 && departTurn(train) > as.turn {
+			as.notify(func(o Observer) {
+				o.TrainBlocked(as.turn, Block{Train: train.Name, From: train.Position, Next: train.Path[1], Reason: BlockedBeforeDeparture})
+			})
+			continue
+		}
+		if as.outside[train.Name] {
+			as.notify(func(o Observer) {
+				o.TrainBlocked(as.turn, Block{Train: train.Name, From: train.Position, Next: train.Path[1], Reason: BlockedOutsideStart})
+			})
+			continue
+		}
+		if train.ReadyAt > as.turn {
+			as.notify(func(o Observer) {
+				o.TrainBlocked(as.turn, Block{Train: train.Name, From: train.Position, Next: train.Path[train.PathPos+1], Reason: BlockedDwelling})
+			})
 			continue
 		}
 		
 		// Check if train can move to next station in path
 		if train.PathPos+1 < len(train.Path) {
 			nextStation := train.Path[train.PathPos+1]
+			level := as.effectivePriority(train)
 			priority := as.calculateMovePriority(train, nextStation)
 			
 			candidates = append(candidates, MoveCandidate{
 				train:       train,
 				nextStation: nextStation,
+				level:       level,
 				priority:    priority,
 			})
 		}
@@ -209,79 +584,210 @@ func (as *AdvancedSimulator) generateMoveCandidates() []MoveCandidate {
 func (as *AdvancedSimulator) calculateMovePriority(train *types.Train, nextStation string) int {
 	priority := 0
 	
-	// Higher priority for trains closer to destination
+	// Higher priority for trains closer to destination, in turns, so fast
+	// trains go ahead of slow ones
 	remainingSteps := len(train.Path) - train.PathPos - 1
-	priority += (1000 - remainingSteps*10)
+	priority += (1000 - train.TravelTurns(remainingSteps)*10)
 	
 	// Higher priority for lower train IDs (consistent ordering)
 	priority += (1000 - train.ID)
 	
 	// Bonus for moving to destination
-	if nextStation == as.end {
+	if nextStation == as.destination(train) {
 		priority += 500
 	}
 	
 	return priority
 }
 
+// compareMoves orders slow trains part-way along a track first, as they
+// cannot stop there, then trains by their effective priority, then by the
+// score from calculateMovePriority
 func (as *AdvancedSimulator) compareMoves(a, b MoveCandidate) bool {
+	if inTransitA, inTransitB := a.train.Progress > 0, b.train.Progress > 0; inTransitA != inTransitB {
+		return inTransitA
+	}
+	if a.level != b.level {
+		return a.level > b.level
+	}
 	return a.priority > b.priority
 }
 
-func (as *AdvancedSimulator) getCurrentOccupiedStations() map[string]bool {
-	occupied := make(map[string]bool)
+func (as *AdvancedSimulator) getCurrentOccupiedStations() map[string]string {
+	occupied := make(map[string]string)
 	
 	for _, train := range as.trains {
-		if train.Position != as.start && train.Position != as.end {
-			occupied[train.Position] = true
+		if as.finished(train) {
+			continue
+		}
+		if as.turning(train) {
+			// A train turning back holds the terminus, unless it has room
+			// for several
+			if as.terminalLimit(train.Position) == 0 {
+				occupied[train.Position] = train.Name
+			}
+			continue
+		}
+		for _, station := range train.Occupies() {
+			if station != as.start && station != as.end {
+				occupied[station] = train.Name
+			}
 		}
 	}
 	
 	return occupied
 }
 
-func (as *AdvancedSimulator) canExecuteMove(candidate MoveCandidate, usedTracks, occupiedStations map[string]bool) bool {
+func (as *AdvancedSimulator) canExecuteMove(candidate MoveCandidate, claims *turnClaims) bool {
+	block, blocked := as.blockReason(candidate, claims)
+	if blocked {
+		// Only these waits last until the train named moves on
+		switch block.Reason {
+		case BlockedStationOccupied, BlockedTrackUsed, BlockedSignal, BlockedHeadway:
+			as.waiting[block.Train] = block
+		case BlockedTerminalFull:
+			// Any train leaving the terminal makes room
+			occupants := claims.occupants(as, block.Next)
+			if len(occupants) > 0 {
+				block.By = occupants[0]
+				as.waiting[block.Train] = block
+				as.waitingAny[block.Train] = occupants
+			}
+		}
+		if !as.queuedBehind(candidate.train, block) {
+			candidate.train.Waited++
+		}
+		as.notify(func(o Observer) { o.TrainBlocked(as.scheduler.timeStep, block) })
+	}
+	return !blocked
+}
+
+// blockReason reports whether a move is blocked, why, and by which train
+func (as *AdvancedSimulator) blockReason(candidate MoveCandidate, claims *turnClaims) (Block, bool) {
+	block := Block{
+		Train: candidate.train.Name,
+		From:  candidate.train.Position,
+		Next:  candidate.nextStation,
+	}
+	
 	track := as.getTrackKey(candidate.train.Position, candidate.nextStation)
+	trackUser := claims.tracks[track]
+	if trackUser == candidate.train.Name {
+		// Its own body holds the track, which it frees as it moves
+		trackUser = ""
+	}
 	
-	// Check if track is available
-	if usedTracks[track] {
-		return false
+	// The station a train finishes at has no capacity limit unless one is
+	// set for it
+	occupant, full := "", false
+	if limit := as.terminalLimit(candidate.nextStation); limit > 0 {
+		full = claims.load[candidate.nextStation] >= limit
+	} else if len(candidate.train.Legs) > 0 || candidate.nextStation != as.destination(candidate.train) {
+		occupant = claims.stations[candidate.nextStation]
+	}
+	if occupant == candidate.train.Name {
+		occupant = ""
 	}
 	
-	// Check if destination is available (except for end station)
-	if candidate.nextStation != as.end && occupiedStations[candidate.nextStation] {
-		return false
+	switch {
+	case trackUser == "" && occupant == "":
+		if full {
+			block.Reason = BlockedTerminalFull
+			return block, true
+		}
+		if service, blocked := as.checkService(candidate, block); blocked {
+			return service, true
+		}
+		return as.checkSignals(candidate, claims, block)
+	case candidate.train.PathPos == 0 && candidate.train.Leg == 0:
+		// Queued behind the trains that left before it
+		block.Reason, block.By = BlockedWaitingAtStart, occupant
+		if occupant == "" {
+			block.By = trackUser
+		}
+	case occupant != "" && claims.entered[candidate.nextStation]:
+		// A train ahead in priority order took the station this turn
+		block.Reason, block.By = BlockedLostPriority, occupant
+	case trackUser != "":
+		block.Reason, block.By = BlockedTrackUsed, trackUser
+	default:
+		block.Reason, block.By = BlockedStationOccupied, occupant
 	}
 	
-	return true
+	return block, true
 }
 
 func (as *AdvancedSimulator) executeMove(candidate MoveCandidate) {
 	candidate.train.Position = candidate.nextStation
 	candidate.train.PathPos++
+	candidate.train.Progress = 0
 }
 
+// calculateMaxTurns bounds the length of a run; SetMaxTurns overrides it.
+// Every train queued on the longest route may hold up the last one by the
+// longest a train keeps a station or track from the next.
 func (as *AdvancedSimulator) calculateMaxTurns() int {
-	// Estimate maximum turns needed
-	shortestPathLen := 0
-	if len(as.trains) > 0 && len(as.trains[0].Path) > 0 {
-		shortestPathLen = len(as.trains[0].Path) - 1
+	if as.turnLimit > 0 {
+		return as.turnLimit
+	}
+	
+	longestPathLen, legs := 0, 1
+	for _, train := range as.trains {
+		length := len(train.Path) - 1
+		for _, leg := range train.Legs {
+			length += len(leg) - 1
+		}
+		longestPathLen = max(longestPathLen, length)
+		legs = max(legs, len(train.Legs)+1)
 	}
 	
-	// Conservative estimate: base path length + congestion factor
-	maxTurns := shortestPathLen + as.numTrains + 10
+	latestDepart, slowest, longestDwell := 1, 1, 0
+	for _, train := range as.trains {
+		latestDepart = max(latestDepart, departTurn(train))
+		slowest = max(slowest, train.TurnsPerTrack())
+		// The tail of a long train clears each station it holds at the
+		// train's own speed
+		longestDwell = max(longestDwell, train.Dwell+(train.Span()-1)*train.TurnsPerTrack())
+	}
+	for _, station := range as.network.Stations {
+		longestDwell = max(longestDwell, station.Dwell)
+	}
+	signalHeadway := 1
+	for _, train := range as.trains {
+		signalHeadway = max(signalHeadway, as.signalHeadway(train.Path))
+	}
+	// Trains on a route cannot overtake, so each reaches a station at most
+	// this long after the train ahead
+	bottleneck := slowest + longestDwell + signalHeadway - 1
 	
-	// Cap at reasonable maximum
-	if maxTurns > 1000 {
-		maxTurns = 1000
+	lastClosure := as.lastClosureTurn()
+	switch {
+	// A closure that never ends may detour a leg over any simple path, and
+	// a train backed off a deadlock has no better bound
+	case as.resolveDeadlocks || as.closedForGood():
+		longestPathLen = max(longestPathLen, legs*(len(as.network.Stations)-1))
+	// Trains wait out a closure or detour only when that arrives sooner
+	case lastClosure > 0:
+		longestPathLen += legs * lastClosure
+	}
+	// A reroute keeps each leg within its slack of the planned one
+	if as.reroute {
+		longestPathLen += legs * as.rerouteSlack
 	}
 	
-	return maxTurns
+	queued := longestPathLen + as.numTrains*legs
+	// Metered services let a train set off only once the trains on its route
+	// are done, so every train adds a whole route
+	if as.service != OneWay && (as.sharedRoutes || lastClosure > 0 || as.reroute || as.resolveDeadlocks) {
+		queued = as.numTrains * (longestPathLen + legs)
+	}
+	// Closures also hold trains at the start until they end
+	return queued*bottleneck + latestDepart - 1 + lastClosure
 }
 
 func (as *AdvancedSimulator) allTrainsAtDestination() bool {
 	for _, train := range as.trains {
-		if train.Position != as.end {
+		if !as.finished(train) {
 			return false
 		}
 	}
@@ -297,10 +803,19 @@ func (as *AdvancedSimulator) getTrackKey(from, to string) string {
 
 // TrainMove represents a single train movement
 type TrainMove struct {
-	TrainName string
-	To        string
+	TrainName string `json:"train"`
+	To        string `json:"to"`
 }
 
 func (tm TrainMove) String() string {
 	return fmt.Sprintf("%s-%s", tm.TrainName, tm.To)
+}
+
+// formatMoves renders one turn in the output format, e.g. "T1-a T2-b"
+func formatMoves(moves []TrainMove) string {
+	parts := make([]string, len(moves))
+	for i, move := range moves {
+		parts[i] = move.String()
+	}
+	return strings.Join(parts, " ")
 }
\ No newline at end of file
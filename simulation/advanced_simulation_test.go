@@ -0,0 +1,38 @@
+package simulation
+
+import (
+	"testing"
+)
+
+func TestMaxTurnsCoversLongSlowTrains(t *testing.T) {
+	tests := []struct {
+		mapName    string
+		start, end string
+		trains     int
+		scenario   string
+	}{
+		{"two_four.map", "two", "four", 7, "trains:\nT1-T6,length=3,speed=1/3\n"},
+		{"two_four.map", "two", "four", 10, "trains:\nT1-T10,length=4,speed=1/4\n"},
+		{"tree.map", "root", "l7", 8, "trains:\nT1-T8,length=3,speed=1/2,dwell=1\n"},
+		{"small_large.map", "small", "large", 9, "trains:\nT1-T9,length=2,speed=1/3\n"},
+		{"long_chain.map", "s1", "s15", 5, "trains:\nT1-T5,length=4,speed=1/3\n"},
+		{"grid.map", "a1", "c3", 6, "trains:\nT1-T6,length=2\n\ndisruptions:\nclose station b2 from turn 2 to 9\n"},
+		{"beginning_terminus.map", "beginning", "terminus", 8, "trains:\nT1-T8,class=freight\n\ndisruptions:\nclose far-terminus from turn 3 to 12\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mapName, func(t *testing.T) {
+			bounded := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			bound, err := bounded.MaxTurns()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unbounded := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			unbounded.SetMaxTurns(100 * bound)
+			if turns := runTurns(t, unbounded); turns > bound {
+				t.Errorf("took %d turns, over the limit of %d", turns, bound)
+			}
+		})
+	}
+}
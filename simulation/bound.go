@@ -0,0 +1,17 @@
+package simulation
+
+// LowerBound is the fewest turns any schedule could take to bring every
+// train from start to end, for trains moving one track per turn without
+// dwelling. The first train needs the shortest route, and as every track
+// carries one train per turn, at most as many trains as the start or the
+// end has tracks can leave or arrive per turn. It returns 0 when the end
+// cannot be reached.
+func (as *AdvancedSimulator) LowerBound() int {
+	path := as.pathfinder.FindPathAvoiding(as.start, as.end, nil, nil)
+	if len(path) < 2 {
+		return 0
+	}
+
+	lanes := min(len(as.network.Connections[as.start]), len(as.network.Connections[as.end]))
+	return len(path) - 1 + (as.numTrains+lanes-1)/lanes - 1
+}
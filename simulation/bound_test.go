@@ -0,0 +1,49 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+)
+
+func TestLowerBound(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		want       int
+	}{
+		// four has a single track, so trains arrive one a turn
+		{name: "one track in", mapName: "two_four.map", start: "two", end: "four", trains: 3, want: 5},
+		{name: "one train", mapName: "two_four.map", start: "two", end: "four", trains: 1, want: 3},
+		// a1 and c3 have two tracks each
+		{name: "two tracks", mapName: "grid.map", start: "a1", end: "c3", trains: 4, want: 5},
+		{name: "odd train out", mapName: "grid.map", start: "a1", end: "c3", trains: 5, want: 6},
+		{name: "long line", mapName: "long_chain.map", start: "s1", end: "s15", trains: 2, want: 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, "")
+			got := simulator.LowerBound()
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+			if turns := runTurns(t, simulator); turns < got {
+				t.Errorf("took %d turns, fewer than the bound %d", turns, got)
+			}
+		})
+	}
+}
+
+func TestLowerBoundNoPath(t *testing.T) {
+	network, err := parser.Parse(strings.NewReader("stations:\na,0,0\nb,1,0\nc,2,0\n\nconnections:\na-b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := NewSimulator(network, "a", "c", 2).LowerBound(); got != 0 {
+		t.Errorf("got %d for an end that cannot be reached, want 0", got)
+	}
+}
@@ -0,0 +1,140 @@
+package simulation
+
+import (
+	"reflect"
+	"testing"
+)
+
+// arrivals records the turn each train reaches its destination
+type arrivals struct {
+	BaseObserver
+	turns map[string]int
+}
+
+func (a *arrivals) TrainArrived(turn int, train, station string) { a.turns[train] = turn }
+
+func TestClassArrivals(t *testing.T) {
+	// long_chain.map is a line of 14 tracks from s1 to s15
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		scenario   string
+		setup      func(*AdvancedSimulator)
+		want       map[string]int
+	}{
+		{
+			name:    "local",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 1,
+			want: map[string]int{"T1": 14},
+		},
+		{
+			name:    "express",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 1,
+			scenario: "trains:\nT1,class=express\n",
+			want:     map[string]int{"T1": 7},
+		},
+		{
+			// A local train dwells at all 13 stations on the way
+			name:    "local dwelling",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 1,
+			scenario: "trains:\nT1,dwell=1\n",
+			want:     map[string]int{"T1": 27},
+		},
+		{
+			// An express train only at the 6 it stops at
+			name:    "express dwelling",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 1,
+			scenario: "trains:\nT1,class=express,dwell=1\n",
+			want:     map[string]int{"T1": 13},
+		},
+		{
+			name:    "three tracks a turn",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 1,
+			scenario: "trains:\nT1,speed=3\n",
+			want:     map[string]int{"T1": 5},
+		},
+		{
+			name:    "freight",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 1,
+			scenario: "trains:\nT1,class=freight\n",
+			want:     map[string]int{"T1": 28},
+		},
+		{
+			name:    "three turns a track",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 1,
+			scenario: "trains:\nT1,speed=1/3\n",
+			want:     map[string]int{"T1": 42},
+		},
+		{
+			// The express train leaves first and the freight train after it
+			// has cleared the first track
+			name:    "express before freight",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 2,
+			scenario: "trains:\nT1,class=freight\nT2,class=express\n",
+			want:     map[string]int{"T1": 29, "T2": 7},
+		},
+		{
+			name:    "priority leaves first",
+			mapName: "two_four.map", start: "two", end: "four", trains: 3,
+			scenario: "trains:\nT3,priority=2\n",
+			want:     map[string]int{"T1": 4, "T2": 5, "T3": 3},
+		},
+		{
+			name:    "priority order",
+			mapName: "two_four.map", start: "two", end: "four", trains: 3,
+			scenario: "trains:\nT2,priority=1\nT3,priority=2\n",
+			want:     map[string]int{"T1": 5, "T2": 4, "T3": 3},
+		},
+		{
+			// Both trains reach c3 in turn 4, which takes one at a time
+			name:    "terminal goes to the first train",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 2,
+			setup:   func(as *AdvancedSimulator) { as.network.Stations["c3"].Capacity = 1 },
+			want:    map[string]int{"T1": 4, "T2": 5},
+		},
+		{
+			name:    "terminal goes to priority",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 2,
+			scenario: "trains:\nT2,priority=2\n",
+			setup:    func(as *AdvancedSimulator) { as.network.Stations["c3"].Capacity = 1 },
+			want:     map[string]int{"T1": 5, "T2": 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			if tt.setup != nil {
+				tt.setup(simulator)
+			}
+			arrived := &arrivals{turns: make(map[string]int)}
+			simulator.AddObserver(arrived)
+			runTurns(t, simulator)
+			if !reflect.DeepEqual(arrived.turns, tt.want) {
+				t.Errorf("arrived in turns %v, want %v", arrived.turns, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressSkipsStations(t *testing.T) {
+	for _, scenario := range []string{"trains:\nT1,class=express\n", "trains:\nT1,class=express,dwell=1\n"} {
+		simulator := newTestSimulator(t, "long_chain.map", "s1", "s15", 1, scenario)
+		var stops []string
+		for !simulator.Done() {
+			moves, err := simulator.Step()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, move := range moves {
+				stops = append(stops, move.To)
+			}
+		}
+		want := []string{"s3", "s5", "s7", "s9", "s11", "s13", "s15"}
+		if !reflect.DeepEqual(stops, want) {
+			t.Errorf("%q: stopped at %v, want %v", scenario, stops, want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// DeadlockError reports trains that wait for each other in a cycle, each
+// holding the station or track the next one needs
+type DeadlockError struct {
+	Turn int
+	// Cycle lists the waiting trains in order; each waits for the next and
+	// the last waits for the first
+	Cycle []Block
+}
+
+func (e *DeadlockError) Error() string {
+	waits := make([]string, len(e.Cycle))
+	for i, block := range e.Cycle {
+		waits[i] = fmt.Sprintf("%s at %s waits for %s at %s", block.Train, block.From, block.By, block.Next)
+	}
+	return fmt.Sprintf("%v at turn %d: %s", errors.ErrDeadlock, e.Turn, strings.Join(waits, ", "))
+}
+
+func (e *DeadlockError) Unwrap() error {
+	return errors.ErrDeadlock
+}
+
+// Trains returns the names of the trains in the cycle
+func (e *DeadlockError) Trains() []string {
+	trains := make([]string, len(e.Cycle))
+	for i, block := range e.Cycle {
+		trains[i] = block.Train
+	}
+	return trains
+}
+
+// Stations returns the stations held by the trains in the cycle
+func (e *DeadlockError) Stations() []string {
+	stations := make([]string, len(e.Cycle))
+	for i, block := range e.Cycle {
+		stations[i] = block.From
+	}
+	return stations
+}
+
+// ResolveDeadlocks makes the simulator break wait-for cycles instead of
+// failing with a DeadlockError
+func (as *AdvancedSimulator) ResolveDeadlocks(resolve bool) {
+	as.resolveDeadlocks = resolve
+}
+
+// findDeadlock looks for a cycle among the trains that spent the last turn
+// waiting for a station or track held by a train that did not move either,
+// or for room at a terminal whose trains did not move either. Such trains
+// can never move again on their own.
+func (as *AdvancedSimulator) findDeadlock() *DeadlockError {
+	if len(as.waiting) == 0 {
+		return nil
+	}
+	stuck := as.stuckTrains()
+
+	// Follow the waits from the first stuck train. Every stuck train waits
+	// for another one, so the chain returns to a train already on it.
+	for _, train := range as.trains {
+		if !stuck[train.Name] {
+			continue
+		}
+		onChain := make(map[string]int)
+		chain := []Block{}
+		for name := train.Name; ; {
+			if at, seen := onChain[name]; seen {
+				return &DeadlockError{Turn: as.turn, Cycle: chain[at:]}
+			}
+			block := as.waiting[name]
+			for _, by := range as.waitsFor(name) {
+				if stuck[by] {
+					block.By = by
+					break
+				}
+			}
+			onChain[name] = len(chain)
+			chain = append(chain, block)
+			name = block.By
+		}
+	}
+
+	return nil
+}
+
+// waitsFor returns the trains a waiting train waits for; it can move once
+// any one of them does
+func (as *AdvancedSimulator) waitsFor(name string) []string {
+	if occupants := as.waitingAny[name]; len(occupants) > 0 {
+		return occupants
+	}
+	return []string{as.waiting[name].By}
+}
+
+// stuckTrains returns the waiting trains that wait only for trains that are
+// stuck too. The others are freed, starting from those waiting for a train
+// that is not waiting at all.
+func (as *AdvancedSimulator) stuckTrains() map[string]bool {
+	waiters := make(map[string][]string)
+	var freed []string
+	for name := range as.waiting {
+		for _, by := range as.waitsFor(name) {
+			if _, waits := as.waiting[by]; waits {
+				waiters[by] = append(waiters[by], name)
+			} else {
+				freed = append(freed, name)
+			}
+		}
+	}
+
+	free := make(map[string]bool)
+	for len(freed) > 0 {
+		name := freed[len(freed)-1]
+		freed = freed[:len(freed)-1]
+		if !free[name] {
+			free[name] = true
+			freed = append(freed, waiters[name]...)
+		}
+	}
+
+	stuck := make(map[string]bool)
+	for name := range as.waiting {
+		if !free[name] {
+			stuck[name] = true
+		}
+	}
+	return stuck
+}
+
+// resolveDeadlock breaks a cycle by rerouting one of its trains, trying the
+// highest numbered first. The train takes a route around the station it
+// waits for and the occupied stations, or just those of the trains waiting
+// for it, or else backs off to the free station it came from. Trains on a
+// track are skipped. It reports whether a train was rerouted.
+func (as *AdvancedSimulator) resolveDeadlock(deadlock *DeadlockError) bool {
+	occupied := as.getCurrentOccupiedStations()
+	cycle := append([]Block(nil), deadlock.Cycle...)
+
+	for i := len(cycle) - 1; i >= 0; i-- {
+		train := as.trainByName(cycle[i].Train)
+		if train.Progress > 0 {
+			continue
+		}
+
+		if path := as.pathAround(train, cycle[i].Next, occupied); len(path) >= 2 {
+			train.Path = append(train.Path[:train.PathPos], path...)
+			return true
+		}
+
+		if train.PathPos == 0 {
+			continue
+		}
+		// A train longer than one station still holds the one behind it
+		prev := train.Path[train.PathPos-1]
+		if _, taken := occupied[prev]; taken {
+			continue
+		}
+
+		// Step back and carry on from there, around the station just left
+		// if possible
+		rest := as.pathfinder.FindPathAvoiding(prev, as.destination(train), map[string]bool{train.Position: true}, nil)
+		if rest == nil {
+			rest = append([]string(nil), train.Path[train.PathPos-1:]...)
+		}
+		train.Path = append(train.Path[:train.PathPos+1], rest...)
+		return true
+	}
+
+	return false
+}
+
+// pathAround finds a route for a train that avoids the station it waits for
+// and every other station held, its own body included, or failing that only
+// those held by itself and the trains waiting for it, which would only head
+// back into it
+func (as *AdvancedSimulator) pathAround(train *types.Train, next string, occupied map[string]string) []string {
+	waiters := make(map[string]bool)
+	for name := range as.waiting {
+		for _, by := range as.waitsFor(name) {
+			if by == train.Name {
+				waiters[name] = true
+			}
+		}
+	}
+
+	for _, waitersOnly := range []bool{false, true} {
+		avoid := map[string]bool{next: true}
+		for station, name := range occupied {
+			if station != train.Position && (!waitersOnly || waiters[name] || name == train.Name) {
+				avoid[station] = true
+			}
+		}
+		if path := as.pathfinder.FindPathAvoiding(train.Position, as.destination(train), avoid, nil); len(path) >= 2 {
+			return path
+		}
+	}
+	return nil
+}
+
+func (as *AdvancedSimulator) trainByName(name string) *types.Train {
+	return as.byName[name]
+}
@@ -0,0 +1,147 @@
+package simulation
+
+import (
+	"testing"
+)
+
+func TestFindDeadlock(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		scenario   string
+		setup      func(*AdvancedSimulator)
+		want       []string // trains in the cycle, or none if the run ends
+	}{
+		{
+			// Slow trains following each other wait for the track ahead
+			// every turn without being stuck
+			name:    "slow trains in line",
+			mapName: "two_four.map", start: "two", end: "four", trains: 6,
+			scenario: "trains:\nT1-T6,class=freight\nT2,length=2\n",
+			setup:    func(as *AdvancedSimulator) {},
+		},
+		{
+			name:    "slow loop",
+			mapName: "small_large.map", start: "small", end: "large", trains: 10,
+			scenario: "trains:\nT1-T9,class=freight\n",
+			setup:    func(as *AdvancedSimulator) { as.SetService(Loop, 2) },
+		},
+		{
+			// T6 is not rerouted from 10 back along the track T5 is on
+			// towards it
+			name:    "held track",
+			mapName: "small_large.map", start: "small", end: "large", trains: 10,
+			scenario: "trains:\nT1-T4,length=1,speed=1/3\nT5-T9,class=freight\nT8,length=2,depart=3\n",
+			setup: func(as *AdvancedSimulator) {
+				as.SetService(Loop, 3)
+				as.EnableRerouting(0)
+			},
+		},
+		{
+			// T3 on its way back is rerouted from r5 back through r4, where
+			// T5 turns back towards it
+			name:    "reroute into a terminal",
+			mapName: "ring.map", start: "r1", end: "r4", trains: 5,
+			scenario: "trains:\nT1,class=freight,length=2,priority=2\nT2,priority=2\nT5,class=freight\n",
+			setup: func(as *AdvancedSimulator) {
+				as.network.Stations["r1"].Capacity = 1
+				as.network.Stations["r4"].Capacity = 2
+				as.SetService(Loop, 1)
+				as.EnableRerouting(0)
+			},
+			want: []string{"T3", "T5"},
+		},
+		{
+			// Closures send T2 back along the stations its own body holds
+			name:    "long train around closures",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 10,
+			scenario: "trains:\nT6-T9,depart=2,length=1\nT8-T9,class=freight,dwell=2\nT2-T7,length=2\n\n" +
+				"disruptions:\nclose a2-a3 from turn 1 to turn 4\nclose c2-c3 from turn 5 to turn 8\n",
+			setup: func(as *AdvancedSimulator) {},
+		},
+		{
+			// T3 at far is held while far-terminus is closed rather than
+			// sent back towards T6 at near
+			name:    "closure ahead of oncoming train",
+			mapName: "beginning_terminus.map", start: "beginning", end: "terminus", trains: 7,
+			scenario: "trains:\nT1,class=local,dwell=1\nT2,class=local,dwell=1,length=2\nT4,class=express,length=2\n" +
+				"T5,class=express\nT6,class=local,length=3\n\ndisruptions:\nclose far-terminus from turn 4 to 6\n",
+			setup: func(as *AdvancedSimulator) {},
+		},
+		{
+			// T3 is kept off the way T1 turns back from desert
+			name:    "terminal on the way back",
+			mapName: "jungle_desert.map", start: "jungle", end: "desert", trains: 5,
+			setup: func(as *AdvancedSimulator) {
+				as.network.Stations["desert"].Capacity = 1
+				as.SetService(Loop, 1)
+				as.EnableRerouting(0)
+			},
+		},
+		{
+			// T2 is rerouted from 22 back through the full terminal 21,
+			// which T4 is turning back from towards it
+			name:    "full terminal",
+			mapName: "small_large.map", start: "00", end: "21", trains: 5,
+			scenario: "trains:\nT3,length=2,depart=3\nT5,class=local,dwell=1,length=2,priority=2\n",
+			setup: func(as *AdvancedSimulator) {
+				as.network.Stations["21"].Capacity = 1
+				as.SetService(Loop, 1)
+				as.EnableRerouting(0)
+			},
+			want: []string{"T2", "T4"},
+		},
+		{
+			name:    "full terminal resolved",
+			mapName: "small_large.map", start: "00", end: "21", trains: 5,
+			scenario: "trains:\nT3,length=2,depart=3\nT5,class=local,dwell=1,length=2,priority=2\n",
+			setup: func(as *AdvancedSimulator) {
+				as.network.Stations["21"].Capacity = 1
+				as.SetService(Loop, 1)
+				as.EnableRerouting(0)
+				as.ResolveDeadlocks(true)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			tt.setup(simulator)
+			_, err := simulator.Run()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("run failed: %v", err)
+				}
+				return
+			}
+			deadlock, ok := err.(*DeadlockError)
+			if !ok {
+				t.Fatalf("got error %v, want a deadlock", err)
+			}
+			if !sameTrains(deadlock.Trains(), tt.want) {
+				t.Errorf("cycle %v, want trains %v", deadlock, tt.want)
+			}
+		})
+	}
+}
+
+// sameTrains reports whether got and want hold the same train names in any
+// order
+func sameTrains(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[string]bool, len(got))
+	for _, name := range got {
+		seen[name] = true
+	}
+	for _, name := range want {
+		if !seen[name] {
+			return false
+		}
+	}
+	return true
+}
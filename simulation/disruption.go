@@ -0,0 +1,365 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// closedSet holds the stations and tracks closed in one turn, each with the
+// last turn of its closure, or 0 if it never reopens
+type closedSet struct {
+	stations map[string]int
+	tracks   map[string]int
+}
+
+// checkClosures reports scenario closures naming stations or tracks the
+// network does not have
+func (as *AdvancedSimulator) checkClosures(scenario *types.Scenario) error {
+	if scenario == nil {
+		return nil
+	}
+	for _, closure := range scenario.Closures {
+		if closure.Station != "" {
+			if _, ok := as.network.Stations[closure.Station]; !ok {
+				return fmt.Errorf("%w: %s: unknown station", errors.ErrInvalidScenario, closure)
+			}
+			continue
+		}
+		if !as.connected(closure.Track[0], closure.Track[1]) {
+			return fmt.Errorf("%w: %s: unknown track", errors.ErrInvalidScenario, closure)
+		}
+	}
+	return nil
+}
+
+func (as *AdvancedSimulator) connected(a, b string) bool {
+	for _, neighbor := range as.network.Connections[a] {
+		if neighbor == b {
+			return true
+		}
+	}
+	return false
+}
+
+// activeClosures returns what is closed in the current turn, or nil if
+// nothing is
+func (as *AdvancedSimulator) activeClosures() *closedSet {
+	if as.scenario == nil {
+		return nil
+	}
+
+	var c *closedSet
+	for _, closure := range as.scenario.Closures {
+		if !closure.ActiveAt(as.turn) {
+			continue
+		}
+		if c == nil {
+			c = &closedSet{stations: make(map[string]int), tracks: make(map[string]int)}
+		}
+		table, key := c.tracks, as.getTrackKey(closure.Track[0], closure.Track[1])
+		if closure.Station != "" {
+			table, key = c.stations, closure.Station
+		}
+		if until, ok := table[key]; !ok || (until != 0 && (closure.To == 0 || closure.To > until)) {
+			table[key] = closure.To
+		}
+	}
+	return c
+}
+
+// checkClosed reports whether a move needs a closed station or track
+func (as *AdvancedSimulator) checkClosed(candidate MoveCandidate, block Block) (Block, bool) {
+	if as.closed == nil {
+		return block, false
+	}
+	if _, ok := as.closed.stations[candidate.nextStation]; ok {
+		block.Reason = BlockedStationClosed
+		return block, true
+	}
+	if _, ok := as.closed.tracks[as.getTrackKey(candidate.train.Position, candidate.nextStation)]; ok {
+		block.Reason = BlockedTrackClosed
+		return block, true
+	}
+	return block, false
+}
+
+// avoidClosures gives trains whose route runs into a closure a route around
+// it, when that arrives sooner than waiting for the closure to end. The way
+// around keeps clear of trains that have set off towards the train, which it
+// would meet head on. Trains with no way around are held until the closure
+// ends; only when it never does may they head towards other trains. Later
+// legs are rerouted around closures that never end straight away, so trains
+// keeping clear of another train's route see the one it will take.
+func (as *AdvancedSimulator) avoidClosures() {
+	if as.closed == nil {
+		return
+	}
+
+	var avoidStations map[string]bool
+	var avoidTracks map[[2]string]bool
+	// around also keeps clear of the stations held, e.g. behind the train
+	// by its own body
+	around := func(from, to string, held []string) []string {
+		if avoidStations == nil {
+			avoidStations, avoidTracks = as.closed.avoid(as)
+		}
+		var added []string
+		for _, station := range held {
+			if !avoidStations[station] {
+				avoidStations[station] = true
+				added = append(added, station)
+			}
+		}
+		path := as.pathfinder.FindPathAvoiding(from, to, avoidStations, avoidTracks)
+		for _, station := range added {
+			delete(avoidStations, station)
+		}
+		return path
+	}
+
+	for _, train := range as.trains {
+		if as.finished(train) || train.Progress > 0 {
+			continue
+		}
+		for i, leg := range train.Legs {
+			if reopens, blocked := as.closedAlong(leg, 0); blocked && reopens == 0 {
+				if path := around(leg[0], leg[len(leg)-1], nil); len(path) >= 2 {
+					train.Legs[i] = path
+				}
+			}
+		}
+
+		reopens, blocked := as.closedAlong(train.Path, train.PathPos)
+		if !blocked {
+			continue
+		}
+		body := train.Occupies()
+		behind := body[:len(body)-1]
+		path := around(train.Position, as.destination(train), append(as.oncoming(train), behind...))
+		if len(path) < 2 && reopens == 0 {
+			path = around(train.Position, as.destination(train), behind)
+		}
+		if len(path) < 2 {
+			continue
+		}
+		remaining := len(train.Path) - train.PathPos - 1
+		if reopens == 0 || len(path)-1 < remaining+reopens-as.turn+1 {
+			train.Path = append(train.Path[:train.PathPos], path...)
+		}
+	}
+}
+
+// oncoming returns the stations held by trains that have set off towards
+// the train, and those they have yet to pass before they reach it
+func (as *AdvancedSimulator) oncoming(train *types.Train) []string {
+	var stations []string
+	for _, other := range as.trains {
+		if other == train || as.finished(other) || (other.Leg == 0 && other.PathPos == 0 && other.Progress == 0) {
+			continue
+		}
+		ahead := append([]string(nil), other.Path[other.PathPos+1:]...)
+		for _, leg := range other.Legs {
+			ahead = append(ahead, leg[1:]...)
+		}
+		for i, station := range ahead {
+			if station == train.Position {
+				stations = append(stations, other.Occupies()...)
+				stations = append(stations, ahead[:i]...)
+				break
+			}
+		}
+	}
+	return stations
+}
+
+// closedAlong reports whether path is closed somewhere after station from,
+// and the turn after which all of it is open again, or 0 if that never
+// happens
+func (as *AdvancedSimulator) closedAlong(path []string, from int) (int, bool) {
+	reopens, blocked := 0, false
+	note := func(until int) {
+		if !blocked || (reopens != 0 && (until == 0 || until > reopens)) {
+			reopens = until
+		}
+		blocked = true
+	}
+
+	for i := from + 1; i < len(path); i++ {
+		if until, ok := as.closed.stations[path[i]]; ok {
+			note(until)
+		}
+		if until, ok := as.closed.tracks[as.getTrackKey(path[i-1], path[i])]; ok {
+			note(until)
+		}
+	}
+	return reopens, blocked
+}
+
+// closingWithin reports whether a closure in force at some turn from now
+// to until is on route
+func (as *AdvancedSimulator) closingWithin(route routeSet, until int) bool {
+	if as.scenario == nil {
+		return false
+	}
+	for _, closure := range as.scenario.Closures {
+		if (closure.To != 0 && closure.To < as.turn) || closure.From > until {
+			continue
+		}
+		if closure.Station != "" && route.stations[closure.Station] {
+			return true
+		}
+		a, b := closure.Track[0], closure.Track[1]
+		if closure.Station == "" && route.tracks[[2]string{min(a, b), max(a, b)}] {
+			return true
+		}
+	}
+	return false
+}
+
+// avoid returns the closed stations and tracks in the form the pathfinder
+// takes
+func (c *closedSet) avoid(as *AdvancedSimulator) (map[string]bool, map[[2]string]bool) {
+	stations := make(map[string]bool, len(c.stations))
+	for station := range c.stations {
+		stations[station] = true
+	}
+	tracks := make(map[[2]string]bool, len(c.tracks))
+	for _, closure := range as.scenario.Closures {
+		if closure.Station == "" && closure.ActiveAt(as.turn) {
+			tracks[closure.Track] = true
+		}
+	}
+	return stations, tracks
+}
+
+// checkClosedOff fails when closures that never end leave a train no way to
+// the end of one of its legs, rather than letting it wait until the turn
+// limit. Trains only ever move along open routes, so this only needs doing
+// in the turns such closures start.
+func (as *AdvancedSimulator) checkClosedOff() error {
+	if as.scenario == nil {
+		return nil
+	}
+
+	var starting []string
+	stations := make(map[string]bool)
+	tracks := make(map[[2]string]bool)
+	for _, closure := range as.scenario.Closures {
+		if closure.To != 0 || closure.From > as.turn {
+			continue
+		}
+		if max(closure.From, 1) == as.turn {
+			starting = append(starting, closure.String())
+		}
+		if closure.Station != "" {
+			stations[closure.Station] = true
+		} else {
+			tracks[closure.Track] = true
+		}
+	}
+	if len(starting) == 0 {
+		return nil
+	}
+
+	for _, train := range as.trains {
+		if as.finished(train) {
+			continue
+		}
+		for _, leg := range append([][]string{{train.Position, as.destination(train)}}, train.Legs...) {
+			from, to := leg[0], leg[len(leg)-1]
+			// A train may leave the closed station it is at
+			avoid := stations
+			if stations[from] {
+				avoid = make(map[string]bool, len(stations))
+				for station := range stations {
+					if station != from {
+						avoid[station] = true
+					}
+				}
+			}
+			if as.pathfinder.FindPathAvoiding(from, to, avoid, tracks) == nil {
+				return fmt.Errorf("%w: %s cannot reach %s from %s after %s", errors.ErrClosedOff, train.Name, to, from, strings.Join(starting, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// closedForGood reports whether a closure of the scenario never ends
+func (as *AdvancedSimulator) closedForGood() bool {
+	if as.scenario != nil {
+		for _, closure := range as.scenario.Closures {
+			if closure.To == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lastClosureTurn is the last turn any closure of the scenario is in force,
+// or where it starts if it never ends
+func (as *AdvancedSimulator) lastClosureTurn() int {
+	last := 0
+	if as.scenario != nil {
+		for _, closure := range as.scenario.Closures {
+			last = max(last, closure.From, closure.To)
+		}
+	}
+	return last
+}
+
+// Delay compares when a train arrived with when it arrived without
+// disruptions
+type Delay struct {
+	Train    string `json:"train"`
+	Baseline int    `json:"baseline"`
+	Arrived  int    `json:"arrived"`
+	Delay    int    `json:"delay"`
+}
+
+// DelayReport sums up how a scenario's closures changed a run
+type DelayReport struct {
+	// Trains lists the trains that arrived at a different turn
+	Trains        []Delay `json:"trains"`
+	TotalDelay    int     `json:"total_delay"`
+	BaselineTurns int     `json:"baseline_turns"`
+	Turns         int     `json:"turns"`
+}
+
+// CompareToBaseline runs the simulation again without the scenario's
+// closures, with the same settings otherwise, and reports how much later
+// each train arrived in this run. It is meant to be called after the run.
+func (as *AdvancedSimulator) CompareToBaseline(ctx context.Context) (*DelayReport, error) {
+	baseline, err := as.Fork()
+	if err != nil {
+		return nil, err
+	}
+	baseline.scenario = as.scenario.WithoutClosures()
+
+	err = baseline.RunFuncContext(ctx, func(int, []TrainMove) error { return nil })
+	if err != nil {
+		return nil, fmt.Errorf("baseline run: %w", err)
+	}
+
+	report := &DelayReport{BaselineTurns: baseline.turn, Turns: as.turn}
+	for _, train := range as.trains {
+		arrived, ok := as.arrivedAt[train.Name]
+		if !ok || arrived == baseline.arrivedAt[train.Name] {
+			continue
+		}
+		delay := Delay{
+			Train:    train.Name,
+			Baseline: baseline.arrivedAt[train.Name],
+			Arrived:  arrived,
+			Delay:    arrived - baseline.arrivedAt[train.Name],
+		}
+		report.Trains = append(report.Trains, delay)
+		report.TotalDelay += delay.Delay
+	}
+	return report, nil
+}
@@ -0,0 +1,163 @@
+package simulation
+
+import (
+	"context"
+	stderrors "errors"
+	"reflect"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+func TestCompareToBaseline(t *testing.T) {
+	// Without closures T1, T2 and T3 arrive in turns 3, 4 and 5
+	tests := []struct {
+		name     string
+		scenario string
+		want     *DelayReport
+	}{
+		{
+			name: "no closures",
+			want: &DelayReport{BaselineTurns: 5, Turns: 5},
+		},
+		{
+			name:     "closure after the run",
+			scenario: "disruptions:\nclose station one from turn 20 to 21\n",
+			want:     &DelayReport{BaselineTurns: 5, Turns: 5},
+		},
+		{
+			name:     "everyone held",
+			scenario: "disruptions:\nclose station one from turn 2 to 3\n",
+			want: &DelayReport{
+				Trains: []Delay{
+					{Train: "T1", Baseline: 3, Arrived: 5, Delay: 2},
+					{Train: "T2", Baseline: 4, Arrived: 6, Delay: 2},
+					{Train: "T3", Baseline: 5, Arrived: 7, Delay: 2},
+				},
+				TotalDelay: 6, BaselineTurns: 5, Turns: 7,
+			},
+		},
+		{
+			// T1 is past one-four before it closes
+			name:     "only later trains held",
+			scenario: "disruptions:\nclose one-four from turn 4 to 4\n",
+			want: &DelayReport{
+				Trains: []Delay{
+					{Train: "T2", Baseline: 4, Arrived: 5, Delay: 1},
+					{Train: "T3", Baseline: 5, Arrived: 6, Delay: 1},
+				},
+				TotalDelay: 2, BaselineTurns: 5, Turns: 6,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "two_four.map", "two", "four", 3, tt.scenario)
+			if _, err := simulator.Run(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := simulator.CompareToBaseline(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClosedOff(t *testing.T) {
+	// Every route from two to four runs through one and one-four
+	tests := []struct {
+		name     string
+		scenario string
+		wantErr  error
+		wantTurn int // turn the run fails in
+	}{
+		{
+			name:     "station closed for good",
+			scenario: "disruptions:\nclose station one at turn 3\n",
+			wantErr:  errors.ErrClosedOff,
+			wantTurn: 3,
+		},
+		{
+			name:     "track closed for good",
+			scenario: "disruptions:\nclose one-four at turn 1\n",
+			wantErr:  errors.ErrClosedOff,
+			wantTurn: 1,
+		},
+		{
+			name:     "closure that ends",
+			scenario: "disruptions:\nclose station one from turn 2 to 4\n",
+		},
+		{
+			name:     "way around",
+			scenario: "disruptions:\nclose station three at turn 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "two_four.map", "two", "four", 3, tt.scenario)
+			_, err := simulator.Run()
+			if !stderrors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && simulator.Turn() != tt.wantTurn {
+				t.Errorf("failed in turn %d, want %d", simulator.Turn(), tt.wantTurn)
+			}
+		})
+	}
+}
+
+func TestAvoidClosures(t *testing.T) {
+	// r1 reaches r4 through r2 in 3 turns, or round the other way in 5
+	tests := []struct {
+		name     string
+		scenario string
+		want     int
+		detour   bool
+	}{
+		{
+			name: "open",
+			want: 3,
+		},
+		{
+			name:     "waiting is quicker",
+			scenario: "disruptions:\nclose station r2 from turn 1 to 1\n",
+			want:     4,
+		},
+		{
+			name:     "as quick either way",
+			scenario: "disruptions:\nclose station r2 from turn 1 to 2\n",
+			want:     5,
+		},
+		{
+			name:     "detour is quicker",
+			scenario: "disruptions:\nclose station r2 from turn 1 to 5\n",
+			want:     5,
+			detour:   true,
+		},
+		{
+			name:     "closed for good",
+			scenario: "disruptions:\nclose station r2 at turn 1\n",
+			want:     5,
+			detour:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "ring.map", "r1", "r4", 1, tt.scenario)
+			if got := runTurns(t, simulator); got != tt.want {
+				t.Errorf("arrived in turn %d, want %d", got, tt.want)
+			}
+			path := simulator.trains[0].Path
+			if detoured := path[1] == "r8"; detoured != tt.detour {
+				t.Errorf("took %v, want a detour: %v", path, tt.detour)
+			}
+		})
+	}
+}
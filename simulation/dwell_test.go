@@ -0,0 +1,97 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+)
+
+// moveLog records every move as "turn train from-to"
+type moveLog struct {
+	BaseObserver
+	moves []string
+}
+
+func (l *moveLog) TrainDeparted(turn int, train, from, to string) {
+	l.moves = append(l.moves, fmt.Sprintf("%d %s %s-%s", turn, train, from, to))
+}
+
+func TestDwell(t *testing.T) {
+	// A line a-b-c-d, run from a to d
+	tests := []struct {
+		name     string
+		dwell    string
+		trains   int
+		scenario string
+		want     []string
+	}{
+		{
+			name:   "station dwell",
+			dwell:  "b,2\n",
+			trains: 1,
+			want:   []string{"1 T1 a-b", "4 T1 b-c", "5 T1 c-d"},
+		},
+		{
+			// The longer of the station's and the train's dwell applies
+			name:     "train dwell",
+			dwell:    "b,2\n",
+			trains:   1,
+			scenario: "trains:\nT1,dwell=1\n",
+			want:     []string{"1 T1 a-b", "4 T1 b-c", "6 T1 c-d"},
+		},
+		{
+			name:   "none at the start and end",
+			dwell:  "a,3\nd,3\n",
+			trains: 1,
+			want:   []string{"1 T1 a-b", "2 T1 b-c", "3 T1 c-d"},
+		},
+		{
+			name:     "express passing through",
+			dwell:    "b,2\n",
+			trains:   1,
+			scenario: "trains:\nT1,class=express\n",
+			want:     []string{"1 T1 a-b", "1 T1 b-c", "2 T1 c-d"},
+		},
+		{
+			name:     "express stopping",
+			dwell:    "c,2\n",
+			trains:   1,
+			scenario: "trains:\nT1,class=express\n",
+			want:     []string{"1 T1 a-b", "1 T1 b-c", "4 T1 c-d"},
+		},
+		{
+			// T2 follows T1 into b as it leaves, and dwells there too
+			name:   "train behind",
+			dwell:  "b,2\n",
+			trains: 2,
+			want:   []string{"1 T1 a-b", "4 T1 b-c", "4 T2 a-b", "5 T1 c-d", "7 T2 b-c", "8 T2 c-d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, err := parser.Parse(strings.NewReader("stations:\na,0,0\nb,1,0\nc,2,0\nd,3,0\n\nconnections:\na-b\nb-c\nc-d\n\ndwell:\n" + tt.dwell))
+			if err != nil {
+				t.Fatal(err)
+			}
+			simulator := NewSimulator(network, "a", "d", tt.trains)
+			if tt.scenario != "" {
+				scenario, err := parser.ParseScenario(strings.NewReader(tt.scenario))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := simulator.SetScenario(scenario); err != nil {
+					t.Fatal(err)
+				}
+			}
+			log := &moveLog{}
+			simulator.AddObserver(log)
+			runTurns(t, simulator)
+			if got, want := strings.Join(log.moves, ", "), strings.Join(tt.want, ", "); got != want {
+				t.Errorf("moved %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package simulation
+
+import (
+	"fmt"
+	"io"
+)
+
+// Explainer is an Observer that writes one line for every train that does
+// not move in a turn, saying why
+type Explainer struct {
+	BaseObserver
+	w io.Writer
+}
+
+// NewExplainer returns an Explainer writing to w
+func NewExplainer(w io.Writer) *Explainer {
+	return &Explainer{w: w}
+}
+
+func (e *Explainer) TrainBlocked(turn int, block Block) {
+	var why string
+	switch block.Reason {
+	case BlockedStationOccupied:
+		why = fmt.Sprintf("%s is at %s", block.By, block.Next)
+	case BlockedTrackUsed:
+		why = fmt.Sprintf("track %s-%s already used by %s", block.From, block.Next, block.By)
+	case BlockedLostPriority:
+		why = fmt.Sprintf("lost %s to %s on priority", block.Next, block.By)
+	case BlockedWaitingAtStart:
+		why = fmt.Sprintf("waiting at start behind %s", block.By)
+	case BlockedBeforeDeparture:
+		why = "not scheduled to depart yet"
+	case BlockedInTransit:
+		why = fmt.Sprintf("still on the track to %s", block.Next)
+	case BlockedDwelling:
+		why = "dwell time not over"
+	case BlockedSignal:
+		why = fmt.Sprintf("signal at danger, %s is in the block", block.By)
+	case BlockedHeadway:
+		why = fmt.Sprintf("keeping headway behind %s", block.By)
+	case BlockedTrackHeadway:
+		why = fmt.Sprintf("track %s-%s closed after %s passed", block.From, block.Next, block.By)
+	case BlockedStationClosed:
+		why = fmt.Sprintf("station %s is closed", block.Next)
+	case BlockedTrackClosed:
+		why = fmt.Sprintf("track %s-%s is closed", block.From, block.Next)
+	case BlockedRouteInUse:
+		why = fmt.Sprintf("route in use by %s", block.By)
+	case BlockedLoopFull:
+		why = "no room on the loop"
+	case BlockedTerminalFull:
+		why = fmt.Sprintf("%s is full", block.Next)
+	case BlockedOutsideStart:
+		why = "waiting outside for room at the start"
+	default:
+		why = block.Reason.String()
+	}
+	fmt.Fprintf(e.w, "turn %d: %s stays at %s: %s\n", turn, block.Train, block.From, why)
+}
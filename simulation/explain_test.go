@@ -0,0 +1,144 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainer(t *testing.T) {
+	tests := []struct {
+		name     string
+		trains   int
+		scenario string
+		want     string
+	}{
+		{
+			name:   "queue at the start",
+			trains: 3,
+			want: "turn 1: T2 stays at two: waiting at start behind T1\n" +
+				"turn 1: T3 stays at two: waiting at start behind T1\n" +
+				"turn 2: T3 stays at two: waiting at start behind T2\n",
+		},
+		{
+			name:     "departure, dwell and closure",
+			trains:   3,
+			scenario: "trains:\nT1,dwell=1\nT2,depart=3\n\ndisruptions:\nclose station one from turn 2 to 3\n",
+			want: "turn 1: T2 stays at two: not scheduled to depart yet\n" +
+				"turn 1: T3 stays at two: waiting at start behind T1\n" +
+				"turn 2: T1 stays at three: dwell time not over\n" +
+				"turn 2: T2 stays at two: not scheduled to depart yet\n" +
+				"turn 2: T3 stays at two: waiting at start behind T1\n" +
+				"turn 3: T1 stays at three: station one is closed\n" +
+				"turn 3: T2 stays at two: waiting at start behind T1\n" +
+				"turn 3: T3 stays at two: waiting at start behind T1\n" +
+				"turn 4: T3 stays at two: waiting at start behind T2\n" +
+				"turn 5: T1 stays at one: dwell time not over\n" +
+				"turn 5: T2 stays at three: T1 is at one\n" +
+				"turn 5: T3 stays at two: waiting at start behind T2\n",
+		},
+		{
+			name:     "slow train",
+			trains:   2,
+			scenario: "trains:\nT1,class=freight,length=2\n",
+			want: "turn 1: T1 stays at two: track two-three already used by T2\n" +
+				"turn 2: T1 stays at two: still on the track to three\n" +
+				"turn 4: T1 stays at three: still on the track to one\n" +
+				"turn 6: T1 stays at one: still on the track to four\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "two_four.map", "two", "four", tt.trains, tt.scenario)
+			var out strings.Builder
+			simulator.AddObserver(NewExplainer(&out))
+			if _, err := simulator.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("explained\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// blockRecorder keeps the blocks reported in a turn
+type blockRecorder struct {
+	BaseObserver
+	blocks []Block
+}
+
+func (r *blockRecorder) TurnStarted(turn int)               { r.blocks = nil }
+func (r *blockRecorder) TrainBlocked(turn int, block Block) { r.blocks = append(r.blocks, block) }
+
+func TestExplainerCoversWaitingTrains(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		scenario   string
+		setup      func(*AdvancedSimulator)
+	}{
+		{
+			name:    "mixed classes",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 10,
+			scenario: "trains:\nT1-T3,class=freight,length=2\nT4,depart=4,dwell=1\nT9,priority=1\n",
+			setup:    func(as *AdvancedSimulator) {},
+		},
+		{
+			name:    "loop with closure",
+			mapName: "small_large.map", start: "small", end: "large", trains: 6,
+			scenario: "disruptions:\nclose 12-large from turn 4 to 6\n",
+			setup:    func(as *AdvancedSimulator) { as.SetService(Loop, 2) },
+		},
+		{
+			name:    "rerouting",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 8,
+			scenario: "trains:\nT1,class=freight,length=2\n",
+			setup:    func(as *AdvancedSimulator) { as.EnableRerouting(2) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			tt.setup(simulator)
+			recorder := &blockRecorder{}
+			simulator.AddObserver(recorder)
+
+			for !simulator.Done() {
+				state, err := simulator.State()
+				if err != nil {
+					t.Fatal(err)
+				}
+				moves, err := simulator.Step()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Every train still running either moves or is explained,
+				// once
+				seen := make(map[string]int)
+				for _, move := range moves {
+					seen[move.TrainName]++
+				}
+				for _, block := range recorder.blocks {
+					seen[block.Train]++
+					if block.From != positions(state)[block.Train] {
+						t.Errorf("turn %d: %s explained at %s, but is at %s", simulator.Turn(), block.Train, block.From, positions(state)[block.Train])
+					}
+				}
+				for _, train := range state.Trains {
+					want := 1
+					if train.Arrived {
+						want = 0
+					}
+					if seen[train.Name] != want {
+						t.Errorf("turn %d: %s moved or was explained %d times, want %d", simulator.Turn(), train.Name, seen[train.Name], want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package simulation
+
+// Fork returns a simulator for the same network, trains and settings that
+// has not run yet. It shares this simulator's pathfinder and planned routes,
+// planning them first if needed, so a fork skips the route search. Observers
+// are not copied. Forks may run concurrently with each other once Fork has
+// returned. It fails when this simulation cannot start.
+func (as *AdvancedSimulator) Fork() (*AdvancedSimulator, error) {
+	if err := as.prepare(); err != nil {
+		return nil, err
+	}
+
+	fork := newAdvancedSimulator(as.network, as.pathfinder, as.start, as.end, as.numTrains)
+	fork.routes = as.routes
+	fork.reroute, fork.rerouteSlack = as.reroute, as.rerouteSlack
+	fork.resolveDeadlocks = as.resolveDeadlocks
+	fork.turnLimit = as.turnLimit
+	fork.agingTurns = as.agingTurns
+	fork.scenario = as.scenario
+	fork.service, fork.cycles = as.service, as.cycles
+	return fork, nil
+}
@@ -0,0 +1,138 @@
+package simulation
+
+// BlockReason says why a train could not make its next move
+type BlockReason int
+
+const (
+	// BlockedStationOccupied means another train holds the next station
+	BlockedStationOccupied BlockReason = iota
+	// BlockedTrackUsed means the track to the next station was already
+	// used this turn
+	BlockedTrackUsed
+	// BlockedLostPriority means a train ahead in priority order moved into
+	// the next station this turn
+	BlockedLostPriority
+	// BlockedWaitingAtStart means the train has not left the start yet
+	// because the trains ahead of it still hold its first track or station
+	BlockedWaitingAtStart
+	// BlockedBeforeDeparture means the train is held at the start until its
+	// scheduled departure turn
+	BlockedBeforeDeparture
+	// BlockedInTransit means a slow train is still on the track to the next
+	// station
+	BlockedInTransit
+	// BlockedDwelling means the train has not yet spent its dwell time at
+	// the station
+	BlockedDwelling
+	// BlockedSignal means another train is in the signal block of the next
+	// track
+	BlockedSignal
+	// BlockedHeadway means another train is too few stations ahead
+	BlockedHeadway
+	// BlockedTrackHeadway means another train used the next track too few
+	// turns ago
+	BlockedTrackHeadway
+	// BlockedStationClosed means the next station is closed
+	BlockedStationClosed
+	// BlockedTrackClosed means the track to the next station is closed
+	BlockedTrackClosed
+	// BlockedRouteInUse means the train waits at a terminus until the train
+	// running its shuttle route comes back
+	BlockedRouteInUse
+	// BlockedLoopFull means the train waits at the start until there is
+	// room on the loop it runs
+	BlockedLoopFull
+	// BlockedTerminalFull means the next station is a start or end station
+	// holding as many trains as it can
+	BlockedTerminalFull
+	// BlockedOutsideStart means the train waits outside a full start
+	// station to be let in
+	BlockedOutsideStart
+)
+
+func (r BlockReason) String() string {
+	switch r {
+	case BlockedStationOccupied:
+		return "station occupied"
+	case BlockedTrackUsed:
+		return "track used"
+	case BlockedLostPriority:
+		return "lost on priority"
+	case BlockedWaitingAtStart:
+		return "waiting at start"
+	case BlockedBeforeDeparture:
+		return "scheduled departure"
+	case BlockedInTransit:
+		return "in transit"
+	case BlockedDwelling:
+		return "dwelling"
+	case BlockedSignal:
+		return "signal"
+	case BlockedHeadway:
+		return "headway"
+	case BlockedTrackHeadway:
+		return "track headway"
+	case BlockedStationClosed:
+		return "station closed"
+	case BlockedTrackClosed:
+		return "track closed"
+	case BlockedRouteInUse:
+		return "route in use"
+	case BlockedLoopFull:
+		return "loop full"
+	case BlockedTerminalFull:
+		return "terminal full"
+	case BlockedOutsideStart:
+		return "outside start"
+	default:
+		return "unknown"
+	}
+}
+
+// Block describes a train that cannot make its next move
+type Block struct {
+	Train  string
+	From   string
+	Next   string
+	Reason BlockReason
+	// By is the train holding the station or track
+	By string
+}
+
+// Observer receives the events of a simulation as they happen. Callbacks
+// run on the simulating goroutine, so they should return quickly.
+type Observer interface {
+	TurnStarted(turn int)
+	// TrainDeparted is called when a train leaves from for to
+	TrainDeparted(turn int, train, from, to string)
+	// TrainArrived is called when a train reaches station; station is the
+	// last one of its service once the train has finished
+	TrainArrived(turn int, train, station string)
+	// TrainBlocked is called when a train cannot make its next move
+	TrainBlocked(turn int, block Block)
+	TurnEnded(turn int, moves []TrainMove)
+}
+
+// BaseObserver implements Observer with no-ops. Embed it to handle only
+// some of the events.
+type BaseObserver struct{}
+
+func (BaseObserver) TurnStarted(turn int)                           {}
+func (BaseObserver) TrainDeparted(turn int, train, from, to string) {}
+func (BaseObserver) TrainArrived(turn int, train, station string)   {}
+func (BaseObserver) TrainBlocked(turn int, block Block)             {}
+func (BaseObserver) TurnEnded(turn int, moves []TrainMove)          {}
+
+// AddObserver registers o to receive simulation events
+func (as *AdvancedSimulator) AddObserver(o Observer) {
+	as.observers = append(as.observers, o)
+}
+
+func (as *AdvancedSimulator) notify(event func(o Observer)) {
+	if len(as.observers) == 0 {
+		return
+	}
+	for _, o := range as.observers {
+		event(o)
+	}
+}
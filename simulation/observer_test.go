@@ -0,0 +1,141 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recorder logs every event it receives, one line each
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) TurnStarted(turn int) {
+	r.events = append(r.events, fmt.Sprintf("%d start", turn))
+}
+
+func (r *recorder) TrainDeparted(turn int, train, from, to string) {
+	r.events = append(r.events, fmt.Sprintf("%d depart %s %s-%s", turn, train, from, to))
+}
+
+func (r *recorder) TrainArrived(turn int, train, station string) {
+	r.events = append(r.events, fmt.Sprintf("%d arrive %s %s", turn, train, station))
+}
+
+func (r *recorder) TrainBlocked(turn int, block Block) {
+	event := fmt.Sprintf("%d block %s %s-%s %s", turn, block.Train, block.From, block.Next, block.Reason)
+	if block.By != "" {
+		event += " by " + block.By
+	}
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) TurnEnded(turn int, moves []TrainMove) {
+	var moved []string
+	for _, move := range moves {
+		moved = append(moved, move.TrainName+"-"+move.To)
+	}
+	r.events = append(r.events, strings.TrimSpace(fmt.Sprintf("%d end %s", turn, strings.Join(moved, " "))))
+}
+
+func TestObserverEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		trains   int
+		scenario string
+		service  Service
+		want     []string
+	}{
+		{
+			name:    "queue",
+			trains:  2,
+			service: OneWay,
+			want: []string{
+				"1 start",
+				"1 depart T1 two-three", "1 arrive T1 three",
+				"1 block T2 two-three waiting at start by T1",
+				"1 end T1-three",
+				"2 start",
+				"2 depart T1 three-one", "2 arrive T1 one",
+				"2 depart T2 two-three", "2 arrive T2 three",
+				"2 end T1-one T2-three",
+				"3 start",
+				"3 depart T1 one-four", "3 arrive T1 four",
+				"3 depart T2 three-one", "3 arrive T2 one",
+				"3 end T1-four T2-one",
+				"4 start",
+				"4 depart T2 one-four", "4 arrive T2 four",
+				"4 end T2-four",
+			},
+		},
+		{
+			// Every station passed is reported, and the move only names
+			// the one the train stops at
+			name:     "express shuttle",
+			trains:   1,
+			scenario: "trains:\nT1,class=express\n",
+			service:  Shuttle,
+			want: []string{
+				"1 start",
+				"1 depart T1 two-three", "1 arrive T1 three",
+				"1 depart T1 three-one", "1 arrive T1 one",
+				"1 end T1-one",
+				"2 start",
+				"2 depart T1 one-four", "2 arrive T1 four",
+				"2 end T1-four",
+				"3 start",
+				"3 depart T1 four-one", "3 arrive T1 one",
+				"3 depart T1 one-three", "3 arrive T1 three",
+				"3 end T1-three",
+				"4 start",
+				"4 depart T1 three-two", "4 arrive T1 two",
+				"4 end T1-two",
+			},
+		},
+		{
+			name:     "waiting",
+			trains:   2,
+			scenario: "trains:\nT1,dwell=1\nT2,depart=2\n",
+			service:  OneWay,
+			want: []string{
+				"1 start",
+				"1 block T2 two-three scheduled departure",
+				"1 depart T1 two-three", "1 arrive T1 three",
+				"1 end T1-three",
+				"2 start",
+				"2 block T1 three-one dwelling",
+				"2 block T2 two-three waiting at start by T1",
+				"2 end",
+				"3 start",
+				"3 depart T1 three-one", "3 arrive T1 one",
+				"3 depart T2 two-three", "3 arrive T2 three",
+				"3 end T1-one T2-three",
+				"4 start",
+				"4 block T1 one-four dwelling",
+				"4 block T2 three-one station occupied by T1",
+				"4 end",
+				"5 start",
+				"5 depart T1 one-four", "5 arrive T1 four",
+				"5 depart T2 three-one", "5 arrive T2 one",
+				"5 end T1-four T2-one",
+				"6 start",
+				"6 depart T2 one-four", "6 arrive T2 four",
+				"6 end T2-four",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "two_four.map", "two", "four", tt.trains, tt.scenario)
+			simulator.SetService(tt.service, 1)
+			events := &recorder{}
+			simulator.AddObserver(events)
+			runTurns(t, simulator)
+			if got, want := strings.Join(events.events, "\n"), strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("events\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package simulation
+
+import "gitea.kood.tech/innocentkwizera1/stations/types"
+
+// DefaultAgingTurns is how many turns a train waits before its priority is
+// raised by one
+const DefaultAgingTurns = 5
+
+// SetAging makes a train that could not move for turns turns in a row count
+// as one priority higher, and so on for every further turns turns, up to the
+// highest priority in the run. Waiting trains thus eventually win against
+// the trains that keep taking their track or station. A value of zero or
+// less turns aging off.
+func (as *AdvancedSimulator) SetAging(turns int) {
+	as.agingTurns = turns
+}
+
+// effectivePriority is the train's priority raised by the time it has been
+// waiting
+func (as *AdvancedSimulator) effectivePriority(train *types.Train) int {
+	if as.agingTurns <= 0 || train.Priority >= as.topPriority {
+		return train.Priority
+	}
+	return min(train.Priority+train.Waited/as.agingTurns, as.topPriority)
+}
+
+// queuedBehind reports whether a train waits at the start only for a train
+// that set off from there ahead of it. It could not have gone first, so the
+// wait does not age it; aging it past the train ahead would only have it
+// checked, and blocked, before that train moves on.
+func (as *AdvancedSimulator) queuedBehind(train *types.Train, block Block) bool {
+	if train.Leg > 0 || train.PathPos > 0 || train.Progress > 0 {
+		return false
+	}
+	ahead := as.trainByName(block.By)
+	return ahead != nil && ahead != train && ahead.Leg == 0 && ahead.Path[0] == train.Path[0]
+}
+
+func topPriority(trains []*types.Train) int {
+	top := 0
+	for i, train := range trains {
+		if i == 0 || train.Priority > top {
+			top = train.Priority
+		}
+	}
+	return top
+}
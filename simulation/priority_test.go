@@ -0,0 +1,78 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+)
+
+// newTestSimulator loads a map from test_maps and applies a scenario given
+// as the text of a scenario file, if any
+func newTestSimulator(t *testing.T, mapName, start, end string, trains int, scenario string) *AdvancedSimulator {
+	t.Helper()
+	network, err := parser.ParseFile("../test_maps/" + mapName)
+	if err != nil {
+		t.Fatalf("%s: %v", mapName, err)
+	}
+	simulator := NewSimulator(network, start, end, trains)
+	if scenario != "" {
+		parsed, err := parser.ParseScenario(strings.NewReader(scenario))
+		if err == nil {
+			err = simulator.SetScenario(parsed)
+		}
+		if err != nil {
+			t.Fatalf("scenario %q: %v", scenario, err)
+		}
+	}
+	return simulator
+}
+
+// runTurns runs the simulation and returns the number of turns it took
+func runTurns(t *testing.T, simulator *AdvancedSimulator) int {
+	t.Helper()
+	if _, err := simulator.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	return simulator.Turn()
+}
+
+func TestAgingKeepsStartQueue(t *testing.T) {
+	// A high priority train raises the top priority, so trains queued at the
+	// start would age past the trains that left ahead of them
+	scenarios := []string{
+		"trains:\nT20,priority=1\n",
+		"trains:\nT19-T20,priority=4\n",
+		"trains:\nT1-T20,speed=1/2\nT20,priority=1\n",
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(strings.Fields(scenario)[1], func(t *testing.T) {
+			unaged := newTestSimulator(t, "tree.map", "root", "l7", 20, scenario)
+			unaged.SetAging(0)
+			want := runTurns(t, unaged)
+
+			aged := newTestSimulator(t, "tree.map", "root", "l7", 20, scenario)
+			if got := runTurns(t, aged); got != want {
+				t.Errorf("took %d turns with aging, %d without", got, want)
+			}
+		})
+	}
+}
+
+func TestAgingLetsWaitingTrainsThrough(t *testing.T) {
+	simulator := newTestSimulator(t, "tree.map", "root", "l7", 3, "")
+	simulator.prepare()
+	low, high := simulator.trains[0], simulator.trains[1]
+	high.Priority = 2
+	simulator.topPriority = 2
+
+	low.Waited = 2 * DefaultAgingTurns
+	if got := simulator.effectivePriority(low); got != 2 {
+		t.Errorf("after %d turns waiting: priority %d, want 2", low.Waited, got)
+	}
+	low.Waited = 10 * DefaultAgingTurns
+	if got := simulator.effectivePriority(low); got != 2 {
+		t.Errorf("aging raised the priority to %d, above the top of 2", got)
+	}
+}
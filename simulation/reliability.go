@@ -0,0 +1,243 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// Percentiles summarises a set of turn counts
+type Percentiles struct {
+	Mean float64 `json:"mean"`
+	P50  int     `json:"p50"`
+	P90  int     `json:"p90"`
+	P99  int     `json:"p99"`
+	Max  int     `json:"max"`
+}
+
+// TurnCount is how many runs took a number of turns
+type TurnCount struct {
+	Turns int `json:"turns"`
+	Runs  int `json:"runs"`
+}
+
+// TrainDelays sums up how late one train arrived over all runs
+type TrainDelays struct {
+	Train string `json:"train"`
+	Percentiles
+}
+
+// ElementDelay sums up the runs in which a station or track failed
+type ElementDelay struct {
+	Element  string `json:"element"`
+	Failures int    `json:"failures"`
+	// TotalDelay adds up the total delay of every run the element failed
+	// in, so runs with several failures count towards each of them
+	TotalDelay int     `json:"total_delay"`
+	MeanDelay  float64 `json:"mean_delay"`
+}
+
+// ReliabilityReport is the outcome of a Monte Carlo reliability simulation
+type ReliabilityReport struct {
+	Seed uint64 `json:"seed"`
+	Runs int    `json:"runs"`
+	// Failed counts the runs that ended in a deadlock or hit the turn limit;
+	// they are left out of the figures below
+	Failed        int            `json:"failed"`
+	BaselineTurns int            `json:"baseline_turns"`
+	Turns         Percentiles    `json:"turns"`
+	Distribution  []TurnCount    `json:"distribution"`
+	Trains        []TrainDelays  `json:"trains"`
+	Elements      []ElementDelay `json:"elements"`
+}
+
+// reliabilityRun is the outcome of one randomised run
+type reliabilityRun struct {
+	failed   []int // indexes of the failures drawn
+	turns    int
+	arrivals map[string]int
+	err      error
+}
+
+// MonteCarlo runs the simulation runs times, each time failing every station
+// and track of reliability with its probability, for its number of turns,
+// starting in a random turn of the undisrupted run. The scenario's train
+// settings apply to every run; its own closures are replaced by the drawn
+// failures. Runs are spread over all CPUs and drawn from seed alone, so a
+// seed always gives the same report.
+func (as *AdvancedSimulator) MonteCarlo(ctx context.Context, reliability *types.Reliability, runs int, seed uint64) (*ReliabilityReport, error) {
+	if runs < 1 {
+		return nil, fmt.Errorf("at least one run is needed, got %d", runs)
+	}
+	if err := as.checkFailures(reliability); err != nil {
+		return nil, err
+	}
+
+	baseline, err := as.Fork()
+	if err != nil {
+		return nil, err
+	}
+	baseline.scenario = as.scenario.WithoutClosures()
+	if err := baseline.RunFuncContext(ctx, func(int, []TrainMove) error { return nil }); err != nil {
+		return nil, fmt.Errorf("baseline run: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]reliabilityRun, runs)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range jobs {
+				results[run] = as.runFailures(ctx, baseline, reliability, seed, run)
+			}
+		}()
+	}
+	for run := 0; run < runs && ctx.Err() == nil; run++ {
+		select {
+		case jobs <- run:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := errors.Canceled(ctx, "reliability simulation"); err != nil {
+		return nil, err
+	}
+
+	return summariseRuns(baseline, reliability, results, seed), nil
+}
+
+// checkFailures reports failures naming stations or tracks the network does
+// not have
+func (as *AdvancedSimulator) checkFailures(reliability *types.Reliability) error {
+	for _, failure := range reliability.Failures {
+		if failure.Station != "" {
+			if _, ok := as.network.Stations[failure.Station]; !ok {
+				return fmt.Errorf("%w: %s: unknown station", errors.ErrInvalidReliability, failure.Element())
+			}
+			continue
+		}
+		if !as.connected(failure.Track[0], failure.Track[1]) {
+			return fmt.Errorf("%w: %s: unknown track", errors.ErrInvalidReliability, failure.Element())
+		}
+	}
+	return nil
+}
+
+// runFailures draws the failures of one run from its own random stream and
+// simulates it
+func (as *AdvancedSimulator) runFailures(ctx context.Context, baseline *AdvancedSimulator, reliability *types.Reliability, seed uint64, run int) reliabilityRun {
+	rng := rand.New(rand.NewPCG(seed, uint64(run)))
+	result := reliabilityRun{}
+	var closures []types.Closure
+	for i, failure := range reliability.Failures {
+		if rng.Float64() >= failure.Probability {
+			continue
+		}
+		from := 1 + rng.IntN(max(baseline.turn, 1))
+		closures = append(closures, failure.Closure(from))
+		result.failed = append(result.failed, i)
+	}
+
+	fork, err := as.Fork()
+	if err != nil {
+		result.err = err
+		return result
+	}
+	fork.scenario = as.scenario.WithClosures(closures)
+	result.err = fork.RunFuncContext(ctx, func(int, []TrainMove) error { return nil })
+	result.turns = fork.turn
+	result.arrivals = fork.arrivedAt
+	return result
+}
+
+// summariseRuns builds the report from the runs that completed
+func summariseRuns(baseline *AdvancedSimulator, reliability *types.Reliability, results []reliabilityRun, seed uint64) *ReliabilityReport {
+	report := &ReliabilityReport{Seed: seed, Runs: len(results), BaselineTurns: baseline.turn}
+	turns := []int{}
+	delays := make([][]int, len(baseline.trains))
+	elements := make([]ElementDelay, len(reliability.Failures))
+	for i, failure := range reliability.Failures {
+		elements[i].Element = failure.Element()
+	}
+
+	for _, result := range results {
+		if result.err != nil {
+			report.Failed++
+			continue
+		}
+		turns = append(turns, result.turns)
+		total := 0
+		for i, train := range baseline.trains {
+			delay := result.arrivals[train.Name] - baseline.arrivedAt[train.Name]
+			delays[i] = append(delays[i], delay)
+			total += delay
+		}
+		for _, i := range result.failed {
+			elements[i].Failures++
+			elements[i].TotalDelay += total
+		}
+	}
+
+	report.Turns = percentiles(turns)
+	report.Distribution = distribution(turns)
+	for i, train := range baseline.trains {
+		report.Trains = append(report.Trains, TrainDelays{Train: train.Name, Percentiles: percentiles(delays[i])})
+	}
+	for _, element := range elements {
+		if element.Failures == 0 {
+			continue
+		}
+		element.MeanDelay = float64(element.TotalDelay) / float64(element.Failures)
+		report.Elements = append(report.Elements, element)
+	}
+	sort.SliceStable(report.Elements, func(i, j int) bool {
+		return report.Elements[i].TotalDelay > report.Elements[j].TotalDelay
+	})
+	return report
+}
+
+// percentiles takes the nearest-rank percentiles of values, which it sorts
+func percentiles(values []int) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+	sort.Ints(values)
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	rank := func(p int) int {
+		return values[max((p*len(values)+99)/100, 1)-1]
+	}
+	return Percentiles{
+		Mean: float64(sum) / float64(len(values)),
+		P50:  rank(50),
+		P90:  rank(90),
+		P99:  rank(99),
+		Max:  values[len(values)-1],
+	}
+}
+
+// distribution counts the runs per number of turns in sorted turns
+func distribution(turns []int) []TurnCount {
+	counts := []TurnCount{}
+	for _, t := range turns {
+		if n := len(counts); n > 0 && counts[n-1].Turns == t {
+			counts[n-1].Runs++
+			continue
+		}
+		counts = append(counts, TurnCount{Turns: t, Runs: 1})
+	}
+	return counts
+}
@@ -0,0 +1,38 @@
+package simulation
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+)
+
+func TestMonteCarloSameAtAnyParallelism(t *testing.T) {
+	reliability, err := parser.ParseReliability(strings.NewReader("failures:\na2-b2 0.3\nb2-c2 0.2 for 3 turns\nstation b2 0.1\nb3-c3 0.25\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := func(procs int) *ReliabilityReport {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+		simulator := newTestSimulator(t, "grid.map", "a1", "c3", 6, "")
+		report, err := simulator.MonteCarlo(context.Background(), reliability, 200, 7)
+		if err != nil {
+			t.Fatalf("GOMAXPROCS=%d: %v", procs, err)
+		}
+		return report
+	}
+
+	serial := report(1)
+	if serial.Runs != 200 || len(serial.Elements) != 4 {
+		t.Fatalf("got %d runs and %d elements, want 200 and 4", serial.Runs, len(serial.Elements))
+	}
+	for _, procs := range []int{4, 8} {
+		if parallel := report(procs); !reflect.DeepEqual(parallel, serial) {
+			t.Errorf("GOMAXPROCS=%d: got %+v, want %+v as with GOMAXPROCS=1", procs, parallel, serial)
+		}
+	}
+}
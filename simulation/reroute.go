@@ -0,0 +1,58 @@
+package simulation
+
+// EnableRerouting lets a blocked train switch to another route through
+// stations that are free right now, as long as that makes the leg it is on
+// at most slack connections longer than planned. Routes are otherwise fixed
+// when the simulation starts.
+func (as *AdvancedSimulator) EnableRerouting(slack int) {
+	as.reroute = true
+	as.rerouteSlack = slack
+}
+
+// rerouteIfBlocked gives a blocked candidate a new route from its current
+// station that avoids occupied stations, the tracks already used from there
+// this turn and the routes trains run the other way. The candidate is returned unchanged when it can move or
+// no acceptable route exists.
+func (as *AdvancedSimulator) rerouteIfBlocked(candidate MoveCandidate, claims *turnClaims) MoveCandidate {
+	// Trains still at the start are queued by the initial assignment, which
+	// already spreads them over the available routes
+	block, blocked := as.blockReason(candidate, claims)
+	if !blocked || block.Reason == BlockedWaitingAtStart {
+		return candidate
+	}
+	// A slow train part-way along a track has to finish it
+	if candidate.train.Progress > 0 {
+		return candidate
+	}
+
+	train := candidate.train
+	avoidStations := make(map[string]bool, len(claims.stations))
+	for station := range claims.stations {
+		// Including those behind it that a long train still holds
+		if station != train.Position {
+			avoidStations[station] = true
+		}
+	}
+	otherWay := as.otherWay(train)
+	for station := range otherWay.stations {
+		if station != train.Position {
+			avoidStations[station] = true
+		}
+	}
+	avoidTracks := otherWay.tracks
+	for _, neighbor := range as.network.Connections[train.Position] {
+		if claims.tracks[as.getTrackKey(train.Position, neighbor)] != "" {
+			avoidTracks[[2]string{train.Position, neighbor}] = true
+		}
+	}
+
+	path := as.pathfinder.FindPathAvoiding(train.Position, as.destination(train), avoidStations, avoidTracks)
+	if len(path) < 2 || train.PathPos+len(path)-1 > as.planned[train.Name]+as.rerouteSlack {
+		return candidate
+	}
+
+	// Keep the stations already visited and continue along the new route
+	train.Path = append(train.Path[:train.PathPos], path...)
+	candidate.nextStation = path[1]
+	return candidate
+}
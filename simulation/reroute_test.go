@@ -0,0 +1,81 @@
+package simulation
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRerouting(t *testing.T) {
+	// T1 and T2 dwell at every station, holding up the trains queued behind
+	// them on both routes out of a1
+	const scenario = "trains:\nT1,dwell=4\nT2,dwell=4\n"
+
+	tests := []struct {
+		name     string
+		trains   int
+		slack    int // rerouting is off if negative
+		train    string
+		wantTurn int // when the train arrives
+		wantLen  int // connections on its route
+	}{
+		{"held without rerouting", 4, -1, "T4", 17, 4},
+		{"free branch of the same length", 4, 0, "T4", 9, 4},
+		{"no branch within the slack", 3, 0, "T3", 17, 4},
+		{"longer branch within the slack", 3, 2, "T3", 11, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "grid.map", "a1", "c3", tt.trains, scenario)
+			if tt.slack >= 0 {
+				simulator.EnableRerouting(tt.slack)
+			}
+			state, err := simulator.State()
+			if err != nil {
+				t.Fatal(err)
+			}
+			planned := make(map[string]int, len(state.Trains))
+			for _, train := range state.Trains {
+				planned[train.Name] = len(train.Path) - 1
+			}
+
+			arrived := make(map[string]int)
+			for !simulator.Done() {
+				before := positions(state)
+				moves, err := simulator.Step()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state, err = simulator.State(); err != nil {
+					t.Fatal(err)
+				}
+				checkState(t, state, before, moves, "a1", "c3")
+				for _, move := range moves {
+					if !slices.Contains(simulator.network.Connections[before[move.TrainName]], move.To) {
+						t.Errorf("turn %d: %s went from %s to %s, which are not connected", state.Turn, move.TrainName, before[move.TrainName], move.To)
+					}
+				}
+				for _, train := range state.Trains {
+					if _, ok := arrived[train.Name]; !ok && train.Arrived {
+						arrived[train.Name] = state.Turn
+					}
+				}
+			}
+
+			for _, train := range state.Trains {
+				if train.Path[0] != "a1" || train.Path[len(train.Path)-1] != "c3" {
+					t.Errorf("%s took %v", train.Name, train.Path)
+				}
+				if tt.slack >= 0 && len(train.Path)-1 > planned[train.Name]+tt.slack {
+					t.Errorf("%s took %v, over %d connections", train.Name, train.Path, planned[train.Name]+tt.slack)
+				}
+				if train.Name != tt.train {
+					continue
+				}
+				if arrived[train.Name] != tt.wantTurn || len(train.Path)-1 != tt.wantLen {
+					t.Errorf("%s arrived in turn %d along %v, want turn %d along %d connections", train.Name, arrived[train.Name], train.Path, tt.wantTurn, tt.wantLen)
+				}
+			}
+		})
+	}
+}
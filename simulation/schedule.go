@@ -0,0 +1,145 @@
+package simulation
+
+import (
+	"sort"
+
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// MissedDeadline records a train that did not arrive by its deadline
+type MissedDeadline struct {
+	Train    string `json:"train"`
+	Deadline int    `json:"deadline"`
+	// Arrived is the turn the train arrived, or 0 if it has not yet
+	Arrived int `json:"arrived,omitempty"`
+}
+
+// SetScenario applies per-train settings such as departure times and
+// deadlines, and the closures to make during the run. It must be called
+// before the first turn, and fails if a closure names a station or track
+// the network does not have.
+func (as *AdvancedSimulator) SetScenario(scenario *types.Scenario) error {
+	if err := as.checkClosures(scenario); err != nil {
+		return err
+	}
+	as.scenario = scenario
+	return nil
+}
+
+// MissedDeadlines lists the trains that arrived after their deadline, or
+// have not arrived although their deadline has passed
+func (as *AdvancedSimulator) MissedDeadlines() []MissedDeadline {
+	var missed []MissedDeadline
+	for _, train := range as.trains {
+		if train.Deadline == 0 {
+			continue
+		}
+		arrived, ok := as.arrivedAt[train.Name]
+		if (ok && arrived > train.Deadline) || (!ok && as.turn > train.Deadline) {
+			missed = append(missed, MissedDeadline{
+				Train:    train.Name,
+				Deadline: train.Deadline,
+				Arrived:  arrived,
+			})
+		}
+	}
+	return missed
+}
+
+// departTurn is the first turn in which a train may leave the start
+func departTurn(train *types.Train) int {
+	return max(train.Depart, 1)
+}
+
+// dwellAt is how many turns train must wait at station when it stops there
+func (as *AdvancedSimulator) dwellAt(train *types.Train, station string) int {
+	if station == as.start || station == as.end {
+		return 0
+	}
+	return max(as.network.Stations[station].Dwell, train.Dwell)
+}
+
+// routeTurns is how many turns train needs along path when nothing is in its
+// way, counting the dwell at every station it stops at, and the longest of
+// those stops
+func (as *AdvancedSimulator) routeTurns(train *types.Train, path []string) (turns, longestStop int) {
+	turns = train.TravelTurns(len(path) - 1)
+	for i := train.TracksPerTurn(); i < len(path)-1; i += train.TracksPerTurn() {
+		dwell := as.dwellAt(train, path[i])
+		turns += dwell
+		longestStop = max(longestStop, dwell)
+	}
+	return turns, longestStop
+}
+
+// serviceTurns is how many turns train needs to run its service along path
+// when nothing is in its way: once, or out and back every cycle
+func (as *AdvancedSimulator) serviceTurns(train *types.Train, path []string) int {
+	turns, _ := as.routeTurns(train, path)
+	if as.service == OneWay {
+		return turns
+	}
+	back, _ := as.routeTurns(train, reversed(path))
+	return as.cycles * (turns + back)
+}
+
+// planRoutes picks one of paths for every train so that each arrives as
+// early as possible. Trains are placed in order of departure, then highest
+// priority, then earliest deadline, then fastest first. The next train may
+// leave along a path once the last one is clear of the start: after the
+// turns it spends on a track, its longest stop plus its length, or the
+// signal headway, whichever is longest. Shuttle and loop trains run back
+// along their path, so the next one waits until the last is done with every
+// leg. Trains cannot overtake, so each arrives serviceTurns after leaving,
+// less one, but after the train ahead. It returns the path index for each
+// train and the turn the last one arrives.
+func (as *AdvancedSimulator) planRoutes(paths [][]string) ([]int, int) {
+	order := make([]int, len(as.trains))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ta, tb := as.trains[order[a]], as.trains[order[b]]
+		if departTurn(ta) != departTurn(tb) {
+			return departTurn(ta) < departTurn(tb)
+		}
+		if ta.Priority != tb.Priority {
+			return ta.Priority > tb.Priority
+		}
+		if ta.Deadline != tb.Deadline {
+			return ta.Deadline != 0 && (tb.Deadline == 0 || ta.Deadline < tb.Deadline)
+		}
+		return ta.TurnsPerTrack()*tb.TracksPerTurn() < tb.TurnsPerTrack()*ta.TracksPerTurn()
+	})
+
+	nextFree := make([]int, len(paths))
+	lastArrival := make([]int, len(paths))
+	for i := range nextFree {
+		nextFree[i] = 1
+	}
+
+	assignment := make([]int, len(as.trains))
+	last := 0
+	for _, i := range order {
+		train := as.trains[i]
+		best, bestArrival := 0, 0
+		for p, path := range paths {
+			leave := max(nextFree[p], departTurn(train))
+			arrival := max(leave+as.serviceTurns(train, path)-1, lastArrival[p]+1)
+			if p == 0 || arrival < bestArrival {
+				best, bestArrival = p, arrival
+			}
+		}
+
+		assignment[i] = best
+		_, longestStop := as.routeTurns(train, paths[best])
+		nextFree[best] = max(nextFree[best], departTurn(train)) + max(train.TurnsPerTrack(), longestStop+train.Span(), as.signalHeadway(paths[best]))
+		if as.service != OneWay {
+			nextFree[best] = bestArrival + 1
+		}
+		lastArrival[best] = bestArrival
+		last = max(last, bestArrival)
+	}
+
+	return assignment, last
+}
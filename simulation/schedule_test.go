@@ -0,0 +1,124 @@
+package simulation
+
+import (
+	"reflect"
+	"testing"
+)
+
+// departures records the turn each train first leaves the start
+type departures struct {
+	BaseObserver
+	start string
+	turns map[string]int
+}
+
+func (d *departures) TrainDeparted(turn int, train, from, to string) {
+	if _, left := d.turns[train]; !left && from == d.start {
+		d.turns[train] = turn
+	}
+}
+
+func TestScheduledDepartures(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		scenario   string
+		want       map[string]int
+	}{
+		{
+			name:    "default",
+			mapName: "two_four.map", start: "two", end: "four", trains: 3,
+			want: map[string]int{"T1": 1, "T2": 2, "T3": 3},
+		},
+		{
+			// T3 takes T2's place in the queue
+			name:    "held back",
+			mapName: "two_four.map", start: "two", end: "four", trains: 3,
+			scenario: "trains:\nT2,depart=3\n",
+			want:     map[string]int{"T1": 1, "T3": 2, "T2": 3},
+		},
+		{
+			name:    "late train on a free route",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 4,
+			scenario: "trains:\nT1,depart=2\n",
+			want:     map[string]int{"T2": 1, "T3": 1, "T1": 2, "T4": 2},
+		},
+		{
+			name:    "group",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 4,
+			scenario: "trains:\n*,depart=3\n",
+			want:     map[string]int{"T1": 3, "T2": 3, "T3": 4, "T4": 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			departed := &departures{start: tt.start, turns: make(map[string]int)}
+			simulator.AddObserver(departed)
+			runTurns(t, simulator)
+			if !reflect.DeepEqual(departed.turns, tt.want) {
+				t.Errorf("departed in turns %v, want %v", departed.turns, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissedDeadlines(t *testing.T) {
+	// Without a scenario T1, T2 and T3 arrive in turns 3, 4 and 5
+	tests := []struct {
+		name     string
+		scenario string
+		turns    int // steps to take, or all if zero
+		want     []MissedDeadline
+	}{
+		{
+			name:     "all met",
+			scenario: "trains:\n*,deadline=5\n",
+		},
+		{
+			name:     "late departure",
+			scenario: "trains:\n*,deadline=4\nT2,depart=3\nT3,deadline=7\n",
+			want:     []MissedDeadline{{Train: "T2", Deadline: 4, Arrived: 5}},
+		},
+		{
+			name:     "zero is no deadline",
+			scenario: "trains:\n*,deadline=0\n",
+		},
+		{
+			name:     "not arrived yet",
+			scenario: "trains:\nT2-T3,deadline=2\n",
+			turns:    3,
+			want:     []MissedDeadline{{Train: "T2", Deadline: 2}, {Train: "T3", Deadline: 2}},
+		},
+		{
+			name:     "not due yet",
+			scenario: "trains:\nT3,deadline=3\n",
+			turns:    3,
+		},
+		{
+			name:     "arrived late",
+			scenario: "trains:\nT2-T3,deadline=2\n",
+			want:     []MissedDeadline{{Train: "T2", Deadline: 2, Arrived: 4}, {Train: "T3", Deadline: 2, Arrived: 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "two_four.map", "two", "four", 3, tt.scenario)
+			if tt.turns == 0 {
+				runTurns(t, simulator)
+			}
+			for turn := 1; turn <= tt.turns; turn++ {
+				if _, err := simulator.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := simulator.MissedDeadlines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missed %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
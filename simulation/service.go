@@ -0,0 +1,380 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// Service is how trains run between the start and end stations
+type Service int
+
+const (
+	// OneWay trains run from the start to the end once
+	OneWay Service = iota
+	// Shuttle trains turn back at the end and return the way they came
+	Shuttle
+	// Loop trains return to the start on a different route where there is
+	// one, so they circulate instead of meeting head on
+	Loop
+)
+
+var serviceNames = map[Service]string{
+	OneWay:  "oneway",
+	Shuttle: "shuttle",
+	Loop:    "loop",
+}
+
+func (s Service) String() string {
+	if name, ok := serviceNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseService returns the service with the given name
+func ParseService(name string) (Service, bool) {
+	for service, serviceName := range serviceNames {
+		if serviceName == name {
+			return service, true
+		}
+	}
+	return OneWay, false
+}
+
+// SetService makes trains run a shuttle or loop service of the given number
+// of round trips, finishing back at the start. A train turning back at the
+// start or end holds that station like any other until it leaves. It must
+// be called before the first turn.
+func (as *AdvancedSimulator) SetService(service Service, cycles int) {
+	as.service = service
+	as.cycles = max(cycles, 1)
+}
+
+// planLegs gives every train the legs of its service after the route it
+// was assigned. A loop returns along a route through none of the stations
+// and tracks the trains leave on, and otherwise retraces it.
+func (as *AdvancedSimulator) planLegs() {
+	if as.service == OneWay {
+		return
+	}
+
+	outbound := newRouteSet()
+	for _, train := range as.trains {
+		outbound.add(train.Path)
+	}
+
+	returns := make(map[string][]string)
+	inbound := newRouteSet()
+	for _, train := range as.trains {
+		key := strings.Join(train.Path, " ")
+		back, ok := returns[key]
+		if !ok {
+			back = as.returnRoute(train.Path, outbound)
+			returns[key] = back
+		}
+		inbound.add(back)
+
+		train.Legs = nil
+		for leg := 1; leg < 2*as.cycles; leg++ {
+			route := back
+			if leg%2 == 0 {
+				route = train.Path
+			}
+			train.Legs = append(train.Legs, append([]string(nil), route...))
+		}
+	}
+	as.sharedRoutes = inbound.overlaps(outbound)
+
+	// Turning back at the start, or finishing at one of limited capacity,
+	// closes a loop into a ring, which trains must never fill
+	as.loopSlots = 0
+	if as.service == Loop && !as.sharedRoutes && (as.cycles > 1 || as.terminalLimit(as.start) > 0) {
+		as.loopSlots = len(outbound.stations) + len(inbound.stations) + 2
+	}
+}
+
+// returnRoute is the route from the end back to the start after path
+func (as *AdvancedSimulator) returnRoute(path []string, outbound routeSet) []string {
+	if as.service == Loop {
+		if back := as.pathfinder.FindPathAvoiding(as.end, as.start, outbound.stations, outbound.tracks); len(back) >= 2 {
+			return back
+		}
+	}
+
+	return reversed(path)
+}
+
+// routeSet holds the stations between the ends of some routes, and all
+// their tracks
+type routeSet struct {
+	stations map[string]bool
+	tracks   map[[2]string]bool
+}
+
+func newRouteSet() routeSet {
+	return routeSet{stations: make(map[string]bool), tracks: make(map[[2]string]bool)}
+}
+
+// add adds the stations and tracks of path to the set
+func (set routeSet) add(path []string) {
+	for _, station := range interior(path) {
+		set.stations[station] = true
+	}
+	for i := 1; i < len(path); i++ {
+		a, b := min(path[i-1], path[i]), max(path[i-1], path[i])
+		set.tracks[[2]string{a, b}] = true
+	}
+}
+
+// overlaps reports whether the sets share a station or track
+func (set routeSet) overlaps(other routeSet) bool {
+	for station := range set.stations {
+		if other.stations[station] {
+			return true
+		}
+	}
+	for track := range set.tracks {
+		if other.tracks[track] {
+			return true
+		}
+	}
+	return false
+}
+
+// finished reports whether the train has reached the end of its last leg
+func (as *AdvancedSimulator) finished(train *types.Train) bool {
+	return len(train.Legs) == 0 && train.PathPos == len(train.Path)-1
+}
+
+// destination is the station the train's current leg ends at
+func (as *AdvancedSimulator) destination(train *types.Train) string {
+	if len(train.Path) == 0 {
+		return as.end
+	}
+	return train.Path[len(train.Path)-1]
+}
+
+// turning reports whether the train is at a terminus, waiting to set off on
+// its next leg
+func (as *AdvancedSimulator) turning(train *types.Train) bool {
+	return train.Leg > 0 && train.PathPos == 0 && train.Progress == 0
+}
+
+// turnBack starts the train's next leg once it has reached the end of the
+// current one
+func (as *AdvancedSimulator) turnBack(train *types.Train) {
+	if len(train.Legs) == 0 || train.PathPos < len(train.Path)-1 {
+		return
+	}
+	train.Path, train.Legs = train.Legs[0], train.Legs[1:]
+	train.PathPos = 0
+	train.Leg++
+	as.planned[train.Name] = len(train.Path) - 1
+}
+
+// meter decides for the turn whether trains keep off the routes of trains
+// that have set off. They do while some stations are run in both
+// directions, which trains rerouted around a closure may have started
+// doing, and while a closure may fall on what is left of a running or
+// waiting train's route before it is done with it, as the train may be
+// rerouted around it to meet others head on.
+func (as *AdvancedSimulator) meter() {
+	as.metered = as.sharedRoutes
+	if as.service == OneWay || as.metered {
+		return
+	}
+	// Legs away from the start and back to it
+	directions := [2]routeSet{newRouteSet(), newRouteSet()}
+	for _, train := range as.trains {
+		if as.finished(train) {
+			continue
+		}
+		if as.closingWithin(routeAhead(train), as.horizon(train)) {
+			as.metered = true
+			return
+		}
+		directions[train.Leg%2].add(train.Path[train.PathPos:])
+		for i, leg := range train.Legs {
+			directions[(train.Leg+1+i)%2].add(leg)
+		}
+	}
+	as.metered = directions[0].overlaps(directions[1])
+}
+
+// horizon is the last turn the train may still run on its route: the turns
+// it needs with nothing in its way, counted from when it may leave, plus one
+// for every other train still running, which it may queue behind
+func (as *AdvancedSimulator) horizon(train *types.Train) int {
+	turns, _ := as.routeTurns(train, train.Path[train.PathPos:])
+	for _, leg := range train.Legs {
+		legTurns, _ := as.routeTurns(train, leg)
+		turns += legTurns
+	}
+	for _, other := range as.trains {
+		if other != train && !as.finished(other) {
+			turns++
+		}
+	}
+	return max(as.turn, departTurn(train)) + turns
+}
+
+// routeAhead returns the stations and tracks the train has yet to run
+func routeAhead(train *types.Train) routeSet {
+	ahead := newRouteSet()
+	for _, path := range append([][]string{train.Path[train.PathPos:]}, train.Legs...) {
+		ahead.add(path)
+	}
+	return ahead
+}
+
+// otherWay returns the stations and tracks other trains have yet to run in
+// the other direction to the train's leg. When routes are not shared, trains
+// turning back are never held, so a train rerouted onto them would meet
+// them head on.
+func (as *AdvancedSimulator) otherWay(train *types.Train) routeSet {
+	set := newRouteSet()
+	if as.service == OneWay || as.sharedRoutes {
+		return set
+	}
+	for _, other := range as.trains {
+		if other == train || as.finished(other) {
+			continue
+		}
+		if other.Leg%2 != train.Leg%2 {
+			set.add(other.Path[other.PathPos:])
+		}
+		for i, leg := range other.Legs {
+			if (other.Leg+1+i)%2 != train.Leg%2 {
+				set.add(leg)
+			}
+		}
+	}
+	return set
+}
+
+// checkService holds a train at a terminus while another train that has
+// set off runs any of its route. It only applies while trains are metered,
+// as trains meeting head on, or queueing for a terminus the train at it has
+// to leave through, would never get past each other. Trains leaving on a
+// loop are held while its ring is full otherwise.
+func (as *AdvancedSimulator) checkService(candidate MoveCandidate, block Block) (Block, bool) {
+	train := candidate.train
+	if train.PathPos > 0 || train.Progress > 0 {
+		return block, false
+	}
+	if as.loopSlots > 0 && !as.metered && train.Leg == 0 {
+		if as.loopRoom(train.Span()) {
+			return block, false
+		}
+		block.Reason = BlockedLoopFull
+		return block, true
+	}
+	if other := as.routeUser(train); other != nil {
+		block.Reason, block.By = BlockedRouteInUse, other.Name
+		return block, true
+	}
+	return block, false
+}
+
+// mayDepart reports whether the service lets a train waiting at the start
+// set off next to the trains running and those taking up span more stations
+// of a loop's ring
+func (as *AdvancedSimulator) mayDepart(train *types.Train, span int) bool {
+	if as.loopSlots > 0 && !as.metered {
+		return as.loopRoom(span + train.Span())
+	}
+	return as.routeUser(train) == nil
+}
+
+// routeUser returns a train that has set off on a route sharing a station or
+// track with the train's, when trains must not share routes, or nil. Trains
+// that may meet a closure ahead before they are done may yet be rerouted
+// anywhere, so they count as sharing every route. That, and sharing routes
+// only because of reroutes, only holds trains yet to leave the start: a
+// train turning back holds its terminus, which trains already on their way
+// may need to reach.
+func (as *AdvancedSimulator) routeUser(train *types.Train) *types.Train {
+	if !as.metered {
+		return nil
+	}
+
+	departing := train.Leg == 0
+	route := routeAhead(train)
+	rerouting := departing && as.closingWithin(route, as.horizon(train))
+	for _, other := range as.trains {
+		if other == train || as.finished(other) || (other.Leg == 0 && other.PathPos == 0 && other.Progress == 0) {
+			continue
+		}
+		used := newRouteSet()
+		for _, path := range append([][]string{other.Path}, other.Legs...) {
+			used.add(path)
+		}
+		if rerouting || ((as.sharedRoutes || departing) && route.overlaps(used)) ||
+			(departing && as.closingWithin(routeAhead(other), as.horizon(other))) {
+			return other
+		}
+	}
+	return nil
+}
+
+// loopRoom reports whether trains taking up span stations fit on the ring of
+// a loop service next to the trains on it, leaving a station free so they
+// can all move on
+func (as *AdvancedSimulator) loopRoom(span int) bool {
+	used := span
+	for _, other := range as.trains {
+		if !as.finished(other) && (other.Leg > 0 || other.PathPos > 0 || other.Progress > 0) {
+			used += other.Span()
+		}
+	}
+	return used < as.loopSlots
+}
+
+// checkLoop reports a train too long to run round the ring of a loop
+// service with a station to spare, which could never leave the start
+func (as *AdvancedSimulator) checkLoop() error {
+	if as.loopSlots == 0 {
+		return nil
+	}
+	for _, train := range as.trains {
+		if train.Span() >= as.loopSlots {
+			return fmt.Errorf("%w: %s is %d stations long, the loop takes %d at most", errors.ErrLoopTooShort, train.Name, train.Span(), as.loopSlots-1)
+		}
+	}
+	return nil
+}
+
+// loopRoute returns the shorter of two station-disjoint routes for every
+// train of a loop service to leave on, keeping the other free for the way
+// back, or nil if there are not two
+func (as *AdvancedSimulator) loopRoute(ctx context.Context) ([][]string, error) {
+	paths, err := as.pathfinder.FindDisjointPathsContext(ctx, as.start, as.end, 2)
+	if err != nil || len(paths) < 2 {
+		return nil, err
+	}
+	if len(paths[1]) < len(paths[0]) {
+		return paths[1:], nil
+	}
+	return paths[:1], nil
+}
+
+// reversed returns path run the other way
+func reversed(path []string) []string {
+	back := make([]string, len(path))
+	for i, station := range path {
+		back[len(path)-1-i] = station
+	}
+	return back
+}
+
+// interior returns the stations of path between its ends
+func interior(path []string) []string {
+	if len(path) < 2 {
+		return nil
+	}
+	return path[1 : len(path)-1]
+}
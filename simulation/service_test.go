@@ -0,0 +1,76 @@
+package simulation
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+func TestLateClosureKeepsServiceUnmetered(t *testing.T) {
+	// The closure starts long after the undisrupted run is over
+	const scenario = "disruptions:\nclose station b2 from turn 80 to 81\n"
+
+	for _, service := range []Service{Shuttle, Loop} {
+		for _, cycles := range []int{1, 2} {
+			t.Run(fmt.Sprintf("%s/%d", service, cycles), func(t *testing.T) {
+				undisrupted := newTestSimulator(t, "grid.map", "a1", "c3", 6, "")
+				undisrupted.SetService(service, cycles)
+				want := runTurns(t, undisrupted)
+
+				disrupted := newTestSimulator(t, "grid.map", "a1", "c3", 6, scenario)
+				disrupted.SetService(service, cycles)
+				if got := runTurns(t, disrupted); got != want {
+					t.Errorf("took %d turns, %d without the closure", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestLoopTooShort(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario string
+		wantErr  error
+	}{
+		{"fits", "trains:\nT1,length=2\n", nil},
+		{"too long", "trains:\nT1,length=3\n", errors.ErrLoopTooShort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, "beethoven_part.map", "verdi", "beethoven", 1, tt.scenario)
+			simulator.SetService(Loop, 2)
+			if _, err := simulator.Run(); !stderrors.Is(err, tt.wantErr) {
+				t.Errorf("Run: got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShuttleRouteChoice(t *testing.T) {
+	// r1 reaches r4 round the ring in 3 tracks one way and 5 the other. A
+	// shuttle train holds its route until it is back, so the next one is
+	// quicker round the long way than queueing for the short one.
+	tests := []struct {
+		trains, cycles int
+		want           int
+	}{
+		{trains: 1, cycles: 1, want: 6},
+		{trains: 2, cycles: 1, want: 10},
+		{trains: 3, cycles: 1, want: 12},
+		{trains: 3, cycles: 2, want: 26},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d trains/%d", tt.trains, tt.cycles), func(t *testing.T) {
+			simulator := newTestSimulator(t, "ring.map", "r1", "r4", tt.trains, "")
+			simulator.SetService(Shuttle, tt.cycles)
+			if got := runTurns(t, simulator); got != tt.want {
+				t.Errorf("took %d turns, want %d", got, tt.want)
+			}
+		})
+	}
+}
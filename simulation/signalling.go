@@ -0,0 +1,140 @@
+package simulation
+
+import "gitea.kood.tech/innocentkwizera1/stations/types"
+
+// trackUse records the last train to use a track and when
+type trackUse struct {
+	train string
+	turn  int
+}
+
+// signalling enforces the headway rules and signal blocks of a network on
+// top of the basic occupancy checks
+type signalling struct {
+	rules   types.Signalling
+	blockOf map[string]string   // track -> signal block
+	holder  map[string]string   // signal block -> train in it
+	held    map[string][]string // train -> signal blocks it is in
+	lastUse map[string]trackUse // track -> last train to use it
+}
+
+// newSignalling returns nil for a network without signalling rules
+func (as *AdvancedSimulator) newSignalling() *signalling {
+	rules := as.network.Signalling
+	if rules.HeadwayStations == 0 && rules.HeadwayTurns == 0 && len(rules.Blocks) == 0 {
+		return nil
+	}
+
+	s := &signalling{
+		rules:   rules,
+		blockOf: make(map[string]string),
+		holder:  make(map[string]string),
+		held:    make(map[string][]string),
+		lastUse: make(map[string]trackUse),
+	}
+	for _, block := range rules.Blocks {
+		for _, conn := range block.Connections {
+			s.blockOf[as.getTrackKey(conn[0], conn[1])] = block.Name
+		}
+	}
+	return s
+}
+
+// checkSignals reports whether a move the occupancy checks allow is held
+// back by a closure, a signal block or a headway rule
+func (as *AdvancedSimulator) checkSignals(candidate MoveCandidate, claims *turnClaims, block Block) (Block, bool) {
+	if block, closed := as.checkClosed(candidate, block); closed {
+		return block, true
+	}
+	s := as.signals
+	if s == nil {
+		return block, false
+	}
+	train := candidate.train
+	track := as.getTrackKey(train.Position, candidate.nextStation)
+
+	if name := s.blockOf[track]; name != "" {
+		if holder := s.holder[name]; holder != "" && holder != train.Name {
+			block.Reason, block.By = BlockedSignal, holder
+			return block, true
+		}
+	}
+
+	if use, ok := s.lastUse[track]; ok && use.train != train.Name && as.scheduler.timeStep-use.turn <= s.rules.HeadwayTurns {
+		block.Reason, block.By = BlockedTrackHeadway, use.train
+		return block, true
+	}
+
+	// Keep the stations beyond the next one clear, up to the end station
+	for i := train.PathPos + 2; i <= train.PathPos+1+s.rules.HeadwayStations && i < len(train.Path)-1; i++ {
+		if ahead := claims.stations[train.Path[i]]; ahead != "" && ahead != train.Name {
+			block.Reason, block.By = BlockedHeadway, ahead
+			return block, true
+		}
+	}
+
+	return block, false
+}
+
+// enterSignalBlock puts train in the signal block of track, if any
+func (as *AdvancedSimulator) enterSignalBlock(train *types.Train, track string) {
+	if as.signals == nil {
+		return
+	}
+	if name := as.signals.blockOf[track]; name != "" {
+		as.signals.holder[name] = train.Name
+		as.signals.held[train.Name] = append(as.signals.held[train.Name], name)
+	}
+}
+
+// recordSignals notes that train used track and updates the signal blocks it
+// is in: those of the tracks under it and of the track it last came along.
+// A train at the end station is in none.
+func (as *AdvancedSimulator) recordSignals(train *types.Train, track string) {
+	s := as.signals
+	if s == nil {
+		return
+	}
+	s.lastUse[track] = trackUse{train: train.Name, turn: as.scheduler.timeStep}
+
+	for _, name := range s.held[train.Name] {
+		if s.holder[name] == train.Name {
+			delete(s.holder, name)
+		}
+	}
+	delete(s.held, train.Name)
+	if as.finished(train) {
+		return
+	}
+
+	behind := train.Path[max(train.PathPos-train.Span(), 0) : train.PathPos+1]
+	for i := 1; i < len(behind); i++ {
+		as.enterSignalBlock(train, as.getTrackKey(behind[i-1], behind[i]))
+	}
+}
+
+// signalHeadway is how many turns apart the signalling lets trains leave
+// along path
+func (as *AdvancedSimulator) signalHeadway(path []string) int {
+	s := as.signals
+	if s == nil {
+		return 1
+	}
+
+	headway := max(s.rules.HeadwayStations, s.rules.HeadwayTurns) + 1
+	run, runBlock := 0, ""
+	for i := 1; i < len(path); i++ {
+		name := s.blockOf[as.getTrackKey(path[i-1], path[i])]
+		switch {
+		case name == "":
+			run = 0
+		case name == runBlock:
+			run++
+		default:
+			run = 1
+		}
+		runBlock = name
+		headway = max(headway, run)
+	}
+	return headway
+}
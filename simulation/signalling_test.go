@@ -0,0 +1,143 @@
+package simulation
+
+import (
+	"strconv"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+func TestSignalling(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		scenario   string
+		rules      types.Signalling
+	}{
+		{
+			name:    "headway stations",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 5,
+			rules: types.Signalling{HeadwayStations: 2},
+		},
+		{
+			name:    "headway turns",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 5,
+			rules: types.Signalling{HeadwayTurns: 2},
+		},
+		{
+			name:    "block on a line",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 4,
+			rules: types.Signalling{Blocks: []types.SignalBlock{
+				{Name: "middle", Connections: [][2]string{{"s5", "s6"}, {"s6", "s7"}, {"s7", "s8"}}},
+			}},
+		},
+		{
+			name:    "block across both routes",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 6,
+			rules: types.Signalling{Blocks: []types.SignalBlock{
+				{Name: "centre", Connections: [][2]string{{"a2", "a3"}, {"a2", "b2"}, {"b1", "b2"}}},
+			}},
+		},
+		{
+			name:    "everything with slow trains",
+			mapName: "long_chain.map", start: "s1", end: "s15", trains: 6,
+			scenario: "trains:\nT2,class=freight\nT4,length=2\n",
+			rules: types.Signalling{HeadwayStations: 1, HeadwayTurns: 1, Blocks: []types.SignalBlock{
+				{Name: "west", Connections: [][2]string{{"s3", "s4"}, {"s4", "s5"}}},
+				{Name: "east", Connections: [][2]string{{"s10", "s11"}}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			free := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			unsignalled := runTurns(t, free)
+
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			simulator.network.Signalling = tt.rules
+			blockOf := make(map[string]string)
+			for _, block := range tt.rules.Blocks {
+				for _, conn := range block.Connections {
+					blockOf[simulator.getTrackKey(conn[0], conn[1])] = block.Name
+				}
+			}
+
+			state, err := simulator.State()
+			if err != nil {
+				t.Fatal(err)
+			}
+			lastUse := make(map[string]trackUse)
+			inBlock := make(map[string]string) // train -> block it is in
+			for !simulator.Done() {
+				before := positions(state)
+				moves, err := simulator.Step()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state, err = simulator.State(); err != nil {
+					t.Fatal(err)
+				}
+				turn := state.Turn
+
+				for _, move := range moves {
+					track := simulator.getTrackKey(before[move.TrainName], move.To)
+					if use, ok := lastUse[track]; ok && use.train != move.TrainName && turn-use.turn <= tt.rules.HeadwayTurns {
+						t.Errorf("turn %d: %s used %s %d turns after %s", turn, move.TrainName, track, turn-use.turn, use.train)
+					}
+					lastUse[track] = trackUse{train: move.TrainName, turn: turn}
+					inBlock[move.TrainName] = blockOf[track]
+				}
+
+				holders := make(map[string][]string)
+				for _, train := range state.Trains {
+					if train.Arrived {
+						delete(inBlock, train.Name)
+					}
+					if name := inBlock[train.Name]; name != "" {
+						holders[name] = append(holders[name], train.Name)
+					}
+				}
+				for name, trains := range holders {
+					if len(trains) > 1 {
+						t.Errorf("turn %d: %v are all in block %s", turn, trains, name)
+					}
+				}
+
+				if tt.rules.HeadwayStations > 0 {
+					checkStationHeadway(t, state, tt.start, tt.end, tt.rules.HeadwayStations)
+				}
+			}
+
+			if turns := simulator.Turn(); turns <= unsignalled {
+				t.Errorf("took %d turns with signalling, %d without; the rules never held a train", turns, unsignalled)
+			}
+		})
+	}
+}
+
+// checkStationHeadway checks that trains on a line of stations s1, s2, ...
+// keep headway free stations between them
+func checkStationHeadway(t *testing.T, state State, start, end string, headway int) {
+	t.Helper()
+	var at []int
+	for _, train := range state.Trains {
+		if train.Position == start || train.Position == end {
+			continue
+		}
+		n, err := strconv.Atoi(train.Position[1:])
+		if err != nil {
+			t.Fatalf("station %s is not on a line", train.Position)
+		}
+		at = append(at, n)
+	}
+	for i := range at {
+		for j := range at {
+			if i != j && at[i] < at[j] && at[j]-at[i] <= headway {
+				t.Errorf("turn %d: trains at s%d and s%d, %d stations apart", state.Turn, at[i], at[j], at[j]-at[i]-1)
+			}
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package simulation
 
 import (
+	"gitea.kood.tech/innocentkwizera1/stations/graph"
 	"gitea.kood.tech/innocentkwizera1/stations/types"
 )
 
 // NewSimulator creates and returns an AdvancedSimulator for better performance
 func NewSimulator(network *types.Network, start, end string, numTrains int) *AdvancedSimulator {
 	return NewAdvancedSimulator(network, start, end, numTrains)
-}
\ No newline at end of file
+}
+
+// NewSimulatorWithPathfinder is NewSimulator reusing a pathfinder built for
+// network, so simulators of one network, even concurrent ones, share it
+func NewSimulatorWithPathfinder(network *types.Network, pathfinder *graph.AdvancedPathfinder, start, end string, numTrains int) *AdvancedSimulator {
+	return newAdvancedSimulator(network, pathfinder, start, end, numTrains)
+}
@@ -0,0 +1,55 @@
+package simulation
+
+// State is a snapshot of the simulation between turns
+type State struct {
+	Turn   int          `json:"turn"`
+	Trains []TrainState `json:"trains"`
+
+	// OccupiedStations lists the stations holding a train. The start and end
+	// stations are only listed while a shuttle or loop train turns back at
+	// one with no capacity set.
+	OccupiedStations []string `json:"occupied_stations"`
+
+	// UsedTracks lists the tracks used during the last turn, written as
+	// "a-b" with the station names in order
+	UsedTracks []string `json:"used_tracks"`
+}
+
+// TrainState describes one train and the route it follows
+type TrainState struct {
+	Name     string   `json:"name"`
+	Class    string   `json:"class"`
+	Position string   `json:"position"`
+	Path     []string `json:"path"`
+	// Leg counts the legs of a shuttle or loop service already run
+	Leg     int  `json:"leg,omitempty"`
+	Arrived bool `json:"arrived"`
+}
+
+// State returns the current train positions, occupied stations and used
+// tracks, or why the simulation cannot start. The snapshot shares nothing
+// with the simulator.
+func (as *AdvancedSimulator) State() (State, error) {
+	if err := as.prepare(); err != nil {
+		return State{}, err
+	}
+
+	state := State{
+		Turn:             as.turn,
+		Trains:           make([]TrainState, len(as.trains)),
+		OccupiedStations: as.scheduler.stationsAt(as.turn),
+		UsedTracks:       as.scheduler.tracksAt(as.turn),
+	}
+	for i, train := range as.trains {
+		state.Trains[i] = TrainState{
+			Name:     train.Name,
+			Class:    train.Class.String(),
+			Position: train.Position,
+			Path:     append([]string(nil), train.Path...),
+			Leg:      train.Leg,
+			Arrived:  as.finished(train),
+		}
+	}
+
+	return state, nil
+}
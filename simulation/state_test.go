@@ -0,0 +1,261 @@
+package simulation
+
+import (
+	stderrors "errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+)
+
+func TestStepState(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		service    Service
+	}{
+		{"one way", "two_four.map", "two", "four", 4, OneWay},
+		{"grid", "grid.map", "a1", "c3", 6, OneWay},
+		{"shuttle", "jungle_desert.map", "jungle", "desert", 3, Shuttle},
+		{"loop", "small_large.map", "small", "large", 5, Loop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, "")
+			run.SetService(tt.service, 1)
+			want, err := run.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, "")
+			simulator.SetService(tt.service, 1)
+			state, err := simulator.State()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Turn != 0 || len(state.OccupiedStations) != 0 || len(state.UsedTracks) != 0 {
+				t.Fatalf("initial state %+v, want turn 0 with nothing occupied or used", state)
+			}
+			for _, train := range state.Trains {
+				if train.Position != tt.start || train.Path[0] != tt.start || train.Arrived {
+					t.Fatalf("train %+v, want it waiting at %s", train, tt.start)
+				}
+			}
+
+			var schedule []string
+			for !simulator.Done() {
+				before := positions(state)
+				moves, err := simulator.Step()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state, err = simulator.State(); err != nil {
+					t.Fatal(err)
+				}
+				if state.Turn != simulator.Turn() || state.Turn != len(schedule)+1 {
+					t.Fatalf("state at turn %d after %d steps", state.Turn, len(schedule)+1)
+				}
+				schedule = append(schedule, formatMoves(moves))
+				checkState(t, state, before, moves, tt.start, tt.end)
+			}
+			if strings.Join(compactSchedule(schedule), "\n") != strings.Join(want, "\n") {
+				t.Errorf("stepped\n%s\nwant\n%s", strings.Join(schedule, "\n"), strings.Join(want, "\n"))
+			}
+
+			for _, train := range state.Trains {
+				if !train.Arrived {
+					t.Errorf("train %+v has not arrived once done", train)
+				}
+			}
+			if moves, err := simulator.Step(); moves != nil || err != nil || simulator.Turn() != len(schedule) {
+				t.Errorf("step once done: moves %v, error %v, turn %d", moves, err, simulator.Turn())
+			}
+		})
+	}
+}
+
+// positions maps each train to its station
+func positions(state State) map[string]string {
+	at := make(map[string]string, len(state.Trains))
+	for _, train := range state.Trains {
+		at[train.Name] = train.Position
+	}
+	return at
+}
+
+// checkState compares a state after a turn with the moves made in it, for
+// trains one station long that move one connection a turn. A shuttle or
+// loop train turning back holds its terminus.
+func checkState(t *testing.T, state State, before map[string]string, moves []TrainMove, start, end string) {
+	t.Helper()
+	after := positions(state)
+	moved := make(map[string]bool, len(moves))
+	tracks := []string{}
+	for _, move := range moves {
+		if after[move.TrainName] != move.To {
+			t.Errorf("turn %d: %s moved to %s but is at %s", state.Turn, move.TrainName, move.To, after[move.TrainName])
+		}
+		moved[move.TrainName] = true
+		from, to := before[move.TrainName], move.To
+		if from > to {
+			from, to = to, from
+		}
+		tracks = append(tracks, from+"-"+to)
+	}
+	for name, station := range before {
+		if !moved[name] && after[name] != station {
+			t.Errorf("turn %d: %s went from %s to %s without a move", state.Turn, name, station, after[name])
+		}
+	}
+	sort.Strings(tracks)
+	if !reflect.DeepEqual(state.UsedTracks, tracks) {
+		t.Errorf("turn %d: used tracks %v, want %v", state.Turn, state.UsedTracks, tracks)
+	}
+
+	occupied := []string{}
+	for _, train := range state.Trains {
+		turning := train.Leg > 0 && train.Position == train.Path[0]
+		if (train.Position != start && train.Position != end) || (turning && !train.Arrived) {
+			occupied = append(occupied, train.Position)
+		}
+	}
+	sort.Strings(occupied)
+	if !reflect.DeepEqual(state.OccupiedStations, occupied) {
+		t.Errorf("turn %d: occupied stations %v, want %v", state.Turn, state.OccupiedStations, occupied)
+	}
+}
+
+// compactSchedule drops the turns without moves, as Run does
+func compactSchedule(schedule []string) []string {
+	lines := []string{}
+	for _, line := range schedule {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestStateIsSnapshot(t *testing.T) {
+	simulator := newTestSimulator(t, "two_four.map", "two", "four", 2, "")
+	state, err := simulator.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Trains[0].Path[0] = "nowhere"
+	if _, err := simulator.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := simulator.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Trains[0].Path[0] != "two" {
+		t.Errorf("changing a snapshot changed the route to %v", again.Trains[0].Path)
+	}
+	if state.Turn != 0 || state.Trains[0].Position != "two" {
+		t.Errorf("snapshot changed by a step: %+v", state)
+	}
+}
+
+func TestStepTurnLimit(t *testing.T) {
+	simulator := newTestSimulator(t, "two_four.map", "two", "four", 4, "")
+	simulator.SetMaxTurns(2)
+	for turn := 1; turn <= 2; turn++ {
+		if _, err := simulator.Step(); err != nil {
+			t.Fatalf("turn %d: %v", turn, err)
+		}
+	}
+	if _, err := simulator.Step(); !stderrors.Is(err, errors.ErrTurnLimit) {
+		t.Errorf("step past the limit: error %v, want %v", err, errors.ErrTurnLimit)
+	}
+	if simulator.Done() || simulator.Turn() != 2 {
+		t.Errorf("done %v at turn %d after the limit", simulator.Done(), simulator.Turn())
+	}
+}
+
+func TestLongTrainOccupancy(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		scenario   string
+	}{
+		{"alone", "long_chain.map", "s1", "s15", 1, "trains:\nT1,length=3\n"},
+		{"followed", "long_chain.map", "s1", "s15", 3, "trains:\nT1,length=3\nT2,length=2\n"},
+		{"two routes", "grid.map", "a1", "c3", 4, "trains:\n*,length=2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, tt.scenario)
+			if _, err := simulator.State(); err != nil {
+				t.Fatal(err)
+			}
+			lengths := make(map[string]int)
+			for _, train := range simulator.trains {
+				lengths[train.Name] = train.Span()
+			}
+
+			longest := 0
+			for !simulator.Done() {
+				if _, err := simulator.Step(); err != nil {
+					t.Fatal(err)
+				}
+				state, err := simulator.State()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// A train of length n holds the n stations up to its head,
+				// less the start, until it arrives
+				holder := make(map[string]string)
+				for _, train := range state.Trains {
+					if train.Arrived {
+						continue
+					}
+					head := 0
+					for head < len(train.Path) && train.Path[head] != train.Position {
+						head++
+					}
+					body := train.Path[max(head-lengths[train.Name]+1, 0) : head+1]
+					held := 0
+					for _, station := range body {
+						if station == tt.start {
+							continue
+						}
+						if other, ok := holder[station]; ok {
+							t.Errorf("turn %d: %s and %s both hold %s", state.Turn, other, train.Name, station)
+						}
+						holder[station] = train.Name
+						held++
+					}
+					if held == lengths[train.Name] {
+						longest = max(longest, held)
+					}
+				}
+
+				occupied := []string{}
+				for station := range holder {
+					occupied = append(occupied, station)
+				}
+				sort.Strings(occupied)
+				if !reflect.DeepEqual(state.OccupiedStations, occupied) {
+					t.Errorf("turn %d: occupied stations %v, want %v", state.Turn, state.OccupiedStations, occupied)
+				}
+			}
+
+			if want := max(lengths["T1"], lengths["T2"]); longest != want {
+				t.Errorf("no train ever held all %d of its stations", want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package simulation
+
+import (
+	"fmt"
+	"sort"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/types"
+)
+
+// terminalLimit is how many trains the start or end station holds at once,
+// or 0 if there is no limit or station is neither
+func (as *AdvancedSimulator) terminalLimit(station string) int {
+	if station != as.start && station != as.end {
+		return 0
+	}
+	return as.network.Stations[station].Capacity
+}
+
+// checkDepots reports a depot the trains start or finish at that cannot
+// park all of them
+func (as *AdvancedSimulator) checkDepots() error {
+	finish := as.end
+	if as.service != OneWay {
+		finish = as.start
+	}
+	for _, name := range []string{as.start, finish} {
+		station := as.network.Stations[name]
+		if station.Depot && station.Capacity < as.numTrains {
+			return fmt.Errorf("%w: %s holds %d trains, %d needed", errors.ErrDepotFull, name, station.Capacity, as.numTrains)
+		}
+	}
+	return nil
+}
+
+// terminalLoads counts the trains at the start and end stations with
+// limited capacity at the beginning of the turn, and picks the trains
+// waiting to leave a full start that have to wait outside it. Trains are
+// let in in order of departure, then priority, and only once their service
+// lets them set off, so they never keep out a train turning back there.
+func (as *AdvancedSimulator) terminalLoads() (map[string]int, map[string]bool) {
+	loads := make(map[string]int)
+	var waiting []*types.Train
+	for _, train := range as.trains {
+		switch {
+		case as.finished(train):
+			if as.terminalLimit(train.Position) > 0 && as.network.Stations[train.Position].Depot {
+				loads[train.Position]++
+			}
+		case as.turning(train):
+			if as.terminalLimit(train.Position) > 0 {
+				loads[train.Position]++
+			}
+		case train.Leg == 0 && train.PathPos == 0 && train.Progress == 0:
+			waiting = append(waiting, train)
+		}
+	}
+
+	limit := as.terminalLimit(as.start)
+	if limit == 0 {
+		return loads, nil
+	}
+	sort.SliceStable(waiting, func(i, j int) bool {
+		if departTurn(waiting[i]) != departTurn(waiting[j]) {
+			return departTurn(waiting[i]) < departTurn(waiting[j])
+		}
+		return waiting[i].Priority > waiting[j].Priority
+	})
+	outside := make(map[string]bool)
+	span := 0
+	for _, train := range waiting {
+		if loads[as.start] < limit && as.mayDepart(train, span) {
+			loads[as.start]++
+			span += train.Span()
+		} else {
+			outside[train.Name] = true
+		}
+	}
+	return loads, outside
+}
+
+// occupants returns the trains taking up room at a start or end station of
+// limited capacity: those waiting there to set off, turning back there or
+// parked there at a depot
+func (claims *turnClaims) occupants(as *AdvancedSimulator, station string) []string {
+	if names, ok := claims.full[station]; ok {
+		return names
+	}
+	var names []string
+	for _, train := range as.trains {
+		if train.Position != station || train.Progress > 0 || as.outside[train.Name] {
+			continue
+		}
+		if as.finished(train) && !as.network.Stations[station].Depot {
+			continue
+		}
+		names = append(names, train.Name)
+	}
+	if claims.full == nil {
+		claims.full = make(map[string][]string)
+	}
+	claims.full[station] = names
+	return names
+}
+
+// leaveTerminal frees the place a train held at a start or end station of
+// limited capacity as it sets off
+func (as *AdvancedSimulator) leaveTerminal(train *types.Train, claims *turnClaims) {
+	if train.PathPos == 0 && train.Progress == 0 && as.terminalLimit(train.Position) > 0 {
+		claims.load[train.Position]--
+	}
+}
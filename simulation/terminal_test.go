@@ -0,0 +1,114 @@
+package simulation
+
+import (
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"gitea.kood.tech/innocentkwizera1/stations/errors"
+	"gitea.kood.tech/innocentkwizera1/stations/parser"
+)
+
+func TestDepotTooSmall(t *testing.T) {
+	network, err := parser.Parse(strings.NewReader("stations:\na,0,0\nb,1,0\nc,2,0\n\nconnections:\na-b\nb-c\n\ndepots:\nc,1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulator := NewSimulator(network, "a", "c", 3)
+
+	if _, err := simulator.Step(); !stderrors.Is(err, errors.ErrDepotFull) {
+		t.Errorf("Step: got error %v, want %v", err, errors.ErrDepotFull)
+	}
+	if simulator.Done() {
+		t.Error("Done: a run that cannot start is done")
+	}
+	if _, err := simulator.State(); !stderrors.Is(err, errors.ErrDepotFull) {
+		t.Errorf("State: got error %v", err)
+	}
+	if _, err := simulator.MaxTurns(); !stderrors.Is(err, errors.ErrDepotFull) {
+		t.Errorf("MaxTurns: got error %v", err)
+	}
+	if _, err := simulator.Fork(); !stderrors.Is(err, errors.ErrDepotFull) {
+		t.Errorf("Fork: got error %v", err)
+	}
+	if _, err := simulator.Run(); !stderrors.Is(err, errors.ErrDepotFull) {
+		t.Errorf("Run: got error %v", err)
+	}
+}
+
+func TestTerminalMetering(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapName    string
+		start, end string
+		trains     int
+		service    Service
+		capacity   map[string]int
+		want       BlockReason // the block metering has to cause
+	}{
+		{
+			name:    "full start",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 6,
+			capacity: map[string]int{"a1": 1},
+			want:     BlockedOutsideStart,
+		},
+		{
+			name:    "shuttle turning at a full end",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 4, service: Shuttle,
+			capacity: map[string]int{"c3": 1},
+			want:     BlockedTerminalFull,
+		},
+		{
+			name:    "both ends",
+			mapName: "grid.map", start: "a1", end: "c3", trains: 5, service: Shuttle,
+			capacity: map[string]int{"a1": 2, "c3": 1},
+			want:     BlockedTerminalFull,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newTestSimulator(t, tt.mapName, tt.start, tt.end, tt.trains, "")
+			if tt.service != OneWay {
+				simulator.SetService(tt.service, 1)
+			}
+			for name, capacity := range tt.capacity {
+				simulator.network.Stations[name].Capacity = capacity
+			}
+			recorder := &blockRecorder{}
+			simulator.AddObserver(recorder)
+
+			metered := false
+			for !simulator.Done() {
+				state, err := simulator.State()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := simulator.Step(); err != nil {
+					t.Fatal(err)
+				}
+
+				// Trains kept outside the start this turn take up no room
+				outside := make(map[string]bool)
+				for _, block := range recorder.blocks {
+					outside[block.Train] = block.Reason == BlockedOutsideStart
+					metered = metered || block.Reason == tt.want
+				}
+				loads := make(map[string]int)
+				for _, train := range state.Trains {
+					if !train.Arrived && !outside[train.Name] {
+						loads[train.Position]++
+					}
+				}
+				for name, capacity := range tt.capacity {
+					if loads[name] > capacity {
+						t.Errorf("turn %d: %d trains at %s, which holds %d", state.Turn+1, loads[name], name, capacity)
+					}
+				}
+			}
+			if !metered {
+				t.Errorf("no train was held with %v", tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package types
+
+import "fmt"
+
+// DefaultFailureTurns is how long a failure lasts when its duration is not
+// given
+const DefaultFailureTurns = 5
+
+// Reliability lists the stations and tracks that may fail during a run
+type Reliability struct {
+	Failures []Failure
+}
+
+// Failure is the chance that a station or track breaks down once in a run,
+// closing it for Turns turns
+type Failure struct {
+	// Station is set for a station failure, Track for a track failure
+	Station     string
+	Track       [2]string
+	Probability float64
+	Turns       int
+}
+
+// Element names the failing station or track the way closures do, e.g.
+// "station x" or "a-b"
+func (f Failure) Element() string {
+	if f.Station != "" {
+		return "station " + f.Station
+	}
+	return f.Track[0] + "-" + f.Track[1]
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("%s %g for %d turns", f.Element(), f.Probability, f.Turns)
+}
+
+// Closure returns the closure for this failure starting in turn from
+func (f Failure) Closure(from int) Closure {
+	return Closure{Station: f.Station, Track: f.Track, From: from, To: from + f.Turns - 1}
+}
@@ -0,0 +1,113 @@
+package types
+
+import "fmt"
+
+// Scenario adjusts individual trains of a run and disrupts the network
+// during it. Rules are applied in order, so a later rule overrides what an
+// earlier one set for the same train.
+type Scenario struct {
+	Rules    []TrainRule
+	Closures []Closure
+}
+
+// Closure takes a station or a track out of use from turn From to turn To,
+// both included. A To of zero keeps it closed for the rest of the run.
+type Closure struct {
+	// Station is set for a station closure, Track for a track closure
+	Station string
+	Track   [2]string
+	From    int
+	To      int
+}
+
+// ActiveAt reports whether the closure is in force in the given turn
+func (c Closure) ActiveAt(turn int) bool {
+	return turn >= c.From && (c.To == 0 || turn <= c.To)
+}
+
+func (c Closure) String() string {
+	what := "station " + c.Station
+	if c.Station == "" {
+		what = c.Track[0] + "-" + c.Track[1]
+	}
+	if c.To == 0 {
+		return fmt.Sprintf("close %s at turn %d", what, c.From)
+	}
+	return fmt.Sprintf("close %s from turn %d to %d", what, c.From, c.To)
+}
+
+// WithoutClosures returns a copy of the scenario that leaves the network
+// intact
+func (s *Scenario) WithoutClosures() *Scenario {
+	if s == nil {
+		return nil
+	}
+	return &Scenario{Rules: s.Rules}
+}
+
+// WithClosures returns a copy of the scenario with closures in place of its
+// own
+func (s *Scenario) WithClosures(closures []Closure) *Scenario {
+	copied := &Scenario{Closures: closures}
+	if s != nil {
+		copied.Rules = s.Rules
+	}
+	return copied
+}
+
+// TrainRule applies Settings to the trains numbered First to Last. A rule
+// with First == 0 applies to every train.
+type TrainRule struct {
+	First, Last int
+	Settings    TrainSettings
+}
+
+// TrainSettings holds the attributes a scenario can set. Nil fields leave
+// the train unchanged.
+type TrainSettings struct {
+	Depart   *int
+	Deadline *int
+	Class    *TrainClass
+	Speed    *Speed
+	Priority *int
+	Dwell    *int
+	Length   *int
+}
+
+// Matches reports whether the rule applies to the train with the given ID
+func (r TrainRule) Matches(id int) bool {
+	return r.First == 0 || (id >= r.First && id <= r.Last)
+}
+
+// Apply sets the attributes of every matching rule on train
+func (s *Scenario) Apply(train *Train) {
+	if s == nil {
+		return
+	}
+	for _, rule := range s.Rules {
+		if !rule.Matches(train.ID) {
+			continue
+		}
+		if rule.Settings.Depart != nil {
+			train.Depart = *rule.Settings.Depart
+		}
+		if rule.Settings.Deadline != nil {
+			train.Deadline = *rule.Settings.Deadline
+		}
+		if rule.Settings.Class != nil {
+			train.Class = *rule.Settings.Class
+		}
+		if rule.Settings.Speed != nil {
+			train.Speed = *rule.Settings.Speed
+		}
+		if rule.Settings.Priority != nil {
+			train.Priority = *rule.Settings.Priority
+		}
+		if rule.Settings.Dwell != nil {
+			train.Dwell = *rule.Settings.Dwell
+		}
+		if rule.Settings.Length != nil {
+			train.Length = *rule.Settings.Length
+		}
+	}
+}
@@ -5,11 +5,40 @@ import "fmt"
 type Station struct {
 	Name string
 	X, Y int
+	// Dwell is the number of turns a train stopping here must wait before
+	// it may leave
+	Dwell int
+	// Capacity is the number of trains the station holds at once when it
+	// is the start or end of a run; 0 means no limit. Every other station
+	// holds one train.
+	Capacity int
+	// Depot marks a station where trains park: trains that finish at it
+	// stay, taking up its capacity
+	Depot bool
 }
 
 type Network struct {
 	Stations    map[string]*Station
 	Connections map[string][]string
+	Signalling  Signalling
+}
+
+// Signalling holds the separation rules trains must keep
+type Signalling struct {
+	// HeadwayStations is the number of free stations a train keeps ahead of
+	// it on its route
+	HeadwayStations int
+	// HeadwayTurns is the number of turns a track stays closed after a
+	// train used it
+	HeadwayTurns int
+	// Blocks are groups of connections only one train may be in at a time
+	Blocks []SignalBlock
+}
+
+// SignalBlock is a group of connections protected by one signal
+type SignalBlock struct {
+	Name        string
+	Connections [][2]string
 }
 
 // NewNetwork creates a new, empty network
@@ -26,6 +55,142 @@ type Train struct {
 	Position string
 	Path     []string
 	PathPos  int
+
+	// Depart is the first turn the train may leave the start; 0 means
+	// straight away
+	Depart int
+	// Deadline is the last turn by which the train should arrive; 0 means
+	// none
+	Deadline int
+
+	Class TrainClass
+	// Speed overrides the speed of the train's class when set
+	Speed Speed
+	// Progress counts the turns a slow train has spent on the track to its
+	// next station
+	Progress int
+
+	// Priority ranks the train in conflicts; higher wins, default 0
+	Priority int
+	// Waited counts the turns in a row the train could not make its move
+	Waited int
+
+	// Dwell is the least number of turns the train waits at every station
+	// it stops at, on top of the stations' own dwell times
+	Dwell int
+	// ReadyAt is the first turn the train may leave its current station
+	ReadyAt int
+
+	// Length is the number of consecutive stations the train stretches
+	// over, holding the tracks between them too; 0 counts as 1
+	Length int
+
+	// Legs are the routes a shuttle or loop service runs after Path, in
+	// order. The train turns back at the end of each.
+	Legs [][]string
+	// Leg counts the legs the train has finished
+	Leg int
+}
+
+// TrainClass is the kind of service a train runs
+type TrainClass int
+
+const (
+	// Local trains cover one track per turn and stop at every station
+	Local TrainClass = iota
+	// Express trains cover two tracks per turn, passing the station between
+	// them without stopping
+	Express
+	// Freight trains need two turns for every track
+	Freight
+)
+
+var trainClassNames = map[TrainClass]string{
+	Local:   "local",
+	Express: "express",
+	Freight: "freight",
+}
+
+func (c TrainClass) String() string {
+	if name, ok := trainClassNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseTrainClass returns the class with the given name
+func ParseTrainClass(name string) (TrainClass, bool) {
+	for class, className := range trainClassNames {
+		if className == name {
+			return class, true
+		}
+	}
+	return Local, false
+}
+
+// Speed is how fast a train moves: Tracks tracks per turn, or one track per
+// Turns turns. Zero fields count as one.
+type Speed struct {
+	Tracks int
+	Turns  int
+}
+
+// IsZero reports whether the speed is unset
+func (s Speed) IsZero() bool {
+	return s.Tracks == 0 && s.Turns == 0
+}
+
+func (s Speed) String() string {
+	if s.Turns > 1 {
+		return fmt.Sprintf("1/%d", s.Turns)
+	}
+	return fmt.Sprintf("%d", max(s.Tracks, 1))
+}
+
+// speed returns the train's own speed, or the default of its class
+func (t *Train) speed() Speed {
+	if !t.Speed.IsZero() {
+		return t.Speed
+	}
+	switch t.Class {
+	case Express:
+		return Speed{Tracks: 2}
+	case Freight:
+		return Speed{Turns: 2}
+	default:
+		return Speed{Tracks: 1}
+	}
+}
+
+// Span is the number of stations the train occupies at once
+func (t *Train) Span() int {
+	return max(t.Length, 1)
+}
+
+// Occupies returns the stations the train stretches over, from its rear to
+// the station at its head
+func (t *Train) Occupies() []string {
+	if len(t.Path) == 0 {
+		return []string{t.Position}
+	}
+	return t.Path[max(t.PathPos-t.Span()+1, 0) : t.PathPos+1]
+}
+
+// TracksPerTurn is how many tracks the train may cover in one turn
+func (t *Train) TracksPerTurn() int {
+	return max(t.speed().Tracks, 1)
+}
+
+// TurnsPerTrack is how many turns the train needs for one track
+func (t *Train) TurnsPerTrack() int {
+	return max(t.speed().Turns, 1)
+}
+
+// TravelTurns is how many turns the train needs to cover the given number
+// of tracks without stopping
+func (t *Train) TravelTurns(tracks int) int {
+	perTurn := t.TracksPerTurn()
+	return (tracks + perTurn - 1) / perTurn * t.TurnsPerTrack()
 }
 
 func NewTrain(id int, start string) *Train {
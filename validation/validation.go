@@ -27,38 +27,41 @@ func ValidateAndLoad(args []string) (*types.Network, string, string, int, error)
 		return nil, "", "", 0, err
 	}
 
+	if err := Validate(network, start, end, numTrains); err != nil {
+		return nil, "", "", 0, err
+	}
+
+	return network, start, end, numTrains, nil
+}
+
+// Validate checks that a loaded network can run numTrains from start to end
+func Validate(network *types.Network, start, end string, numTrains int) error {
+	return ValidateWithCompact(network, graph.NewCompact(network), start, end, numTrains)
+}
+
+// ValidateWithCompact is Validate reusing a compact graph built for network
+func ValidateWithCompact(network *types.Network, compact *graph.Compact, start, end string, numTrains int) error {
 	if _, ok := network.Stations[start]; !ok {
-		return nil, "", "", 0, errors.ErrStartStationNotFound
+		return errors.ErrStartStationNotFound
 	}
 
 	if _, ok := network.Stations[end]; !ok {
-		return nil, "", "", 0, errors.ErrEndStationNotFound
+		return errors.ErrEndStationNotFound
 	}
 
 	if start == end {
-		return nil, "", "", 0, errors.ErrSameStartAndEnd
-	}
-
-	// Enhanced validation: Check if path exists
-	g := &graph.Graph{Nodes: make(map[string]*graph.Node)}
-	for name := range network.Stations {
-		g.AddNode(name)
-	}
-	for from, neighbors := range network.Connections {
-		for _, to := range neighbors {
-			g.AddEdge(from, to)
-		}
+		return errors.ErrSameStartAndEnd
 	}
 
 	// Verify path exists between start and end
-	if !g.PathExists(start, end) {
-		return nil, "", "", 0, errors.ErrNoPath
+	if !compact.PathExists(start, end) {
+		return errors.ErrNoPath
 	}
 
 	// Validate train count limits
-	if numTrains > 10000 {
-		return nil, "", "", 0, errors.ErrInvalidTrainCount
+	if numTrains <= 0 || numTrains > 10000 {
+		return errors.ErrInvalidTrainCount
 	}
 
-	return network, start, end, numTrains, nil
+	return nil
 }